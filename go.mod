@@ -3,14 +3,16 @@ module main
 go 1.23.5
 
 require (
+	github.com/btcsuite/btcd/btcutil v1.1.5
+	github.com/klauspost/compress v1.17.11
 	github.com/nbd-wtf/go-nostr v0.50.0
 	github.com/neo4j/neo4j-go-driver/v5 v5.27.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/btcsuite/btcd v0.24.2 // indirect
 	github.com/btcsuite/btcd/btcec/v2 v2.3.4 // indirect
-	github.com/btcsuite/btcd/btcutil v1.1.5 // indirect
 	github.com/btcsuite/btcd/chaincfg/chainhash v1.1.0 // indirect
 	github.com/coder/websocket v1.8.12 // indirect
 	github.com/decred/dcrd/crypto/blake256 v1.1.0 // indirect
@@ -0,0 +1,131 @@
+// This module provides the mapping for addressable events and their
+// kind:pubkey:d coordinates.
+
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ========================================
+// Addresses
+// ========================================
+
+// Address is the coordinate of a replaceable or addressable event.
+type Address struct {
+	// The kind of the addressed event.
+	Kind int
+	// The pubkey of the addressed event's author.
+	PubKey string
+	// The d tag of the addressed event. Empty for replaceable events.
+	Identifier string
+}
+
+// String returns the address in kind:pubkey:d form.
+func (a Address) String() string {
+	return fmt.Sprintf("%d:%s:%s", a.Kind, a.PubKey, a.Identifier)
+}
+
+// EventAddress returns the address of an addressable event.
+func EventAddress(event nostr.Event) Address {
+	return Address{
+		Kind:       event.Kind,
+		PubKey:     event.PubKey,
+		Identifier: event.Tags.GetD(),
+	}
+}
+
+// ParseAddress parses a kind:pubkey:d coordinate such as the value of an "a"
+// tag. The kind must be replaceable or addressable, and the pubkey must be a
+// 32-byte lowercase hex string.
+func ParseAddress(coordinate string) (Address, error) {
+	parts := strings.SplitN(coordinate, ":", 3)
+	if len(parts) != 3 {
+		return Address{}, fmt.Errorf("invalid address: %q", coordinate)
+	}
+
+	kind, err := strconv.Atoi(parts[0])
+	if err != nil || kind < 0 {
+		return Address{}, fmt.Errorf("invalid address kind: %q", parts[0])
+	}
+	if !nostr.IsAddressableKind(kind) && !nostr.IsReplaceableKind(kind) {
+		return Address{}, fmt.Errorf("address kind is not replaceable: %d", kind)
+	}
+
+	if !isHexID(parts[1]) {
+		return Address{}, fmt.Errorf("invalid address pubkey: %q", parts[1])
+	}
+
+	return Address{Kind: kind, PubKey: parts[1], Identifier: parts[2]}, nil
+}
+
+// ========================================
+// Address Mapping
+// ========================================
+
+// MapAddress links an addressable event to its Address node with a
+// VERSION_OF relationship, and flags the event as the current revision of the
+// address if it is the newest seen. Deletion requests already imported for
+// the address are applied to the event. Events of other kinds, and events
+// whose address is too large to be indexed, are left unchanged.
+func (m *EventMapping) MapAddress() {
+	if !nostr.IsAddressableKind(m.Event.Kind) {
+		return
+	}
+
+	address := EventAddress(m.Event)
+	if len(address.String()) > maxTagSize {
+		return
+	}
+
+	createdAt := m.Event.CreatedAt.Time().Unix()
+
+	addressNode := NewAddressNode(address)
+	versionRel := NewVersionOfRel(
+		m.EventNode, addressNode, Properties{"created_at": createdAt})
+
+	m.Subgraph.AddNode(addressNode)
+	m.Subgraph.AddRel(versionRel)
+	m.Subgraph.AddStatement(NewCurrentRevisionStatement(
+		address.String(),
+		m.Event.ID,
+		createdAt,
+	))
+	m.Subgraph.AddStatement(NewApplyAddressDeletionsStatement(address.String()))
+}
+
+// ========================================
+// Statements
+// ========================================
+
+// currentRevisionQuery flags the newest revision of an address as current.
+var currentRevisionQuery = newestWinsQuery("a", "Address", "coordinate", "current") + `
+	CALL {
+		WITH a, row
+		MATCH (e:Event)-[:VERSION_OF]->(a)
+		WHERE e.current AND e.id <> row.id
+		REMOVE e.current
+	}
+
+	WITH row
+	MATCH (e:Event { id: row.id })
+	SET e.current = true
+	`
+
+// NewCurrentRevisionStatement creates a statement that flags the given event
+// as the current revision of its address, if it is the newest seen.
+func NewCurrentRevisionStatement(
+	coordinate string,
+	id string,
+	createdAt int64,
+) *Statement {
+	return NewStatement(currentRevisionQuery, Properties{
+		"coordinate": coordinate,
+		"id":         id,
+		"created_at": createdAt,
+	})
+}
@@ -0,0 +1,81 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	pubkey := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		name       string
+		coordinate string
+		want       Address
+		wantErr    bool
+	}{
+		{
+			name:       "addressable",
+			coordinate: "30023:" + pubkey + ":my-post",
+			want:       Address{Kind: 30023, PubKey: pubkey, Identifier: "my-post"},
+		},
+		{
+			name:       "replaceable with empty identifier",
+			coordinate: "10002:" + pubkey + ":",
+			want:       Address{Kind: 10002, PubKey: pubkey},
+		},
+		{
+			name:       "identifier containing colons",
+			coordinate: "30023:" + pubkey + ":a:b",
+			want:       Address{Kind: 30023, PubKey: pubkey, Identifier: "a:b"},
+		},
+		{
+			name:       "regular kind",
+			coordinate: "1:" + pubkey + ":",
+			wantErr:    true,
+		},
+		{
+			name:       "non-numeric kind",
+			coordinate: "x:" + pubkey + ":d",
+			wantErr:    true,
+		},
+		{
+			name:       "invalid pubkey",
+			coordinate: "30023:abc:d",
+			wantErr:    true,
+		},
+		{
+			name:       "missing identifier",
+			coordinate: "30023:" + pubkey,
+			wantErr:    true,
+		},
+		{
+			name:       "empty",
+			coordinate: "",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAddress(tt.coordinate)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseAddress(%q) = %v, want error",
+						tt.coordinate, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAddress(%q) failed: %s", tt.coordinate, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAddress(%q) = %v, want %v",
+					tt.coordinate, got, tt.want)
+			}
+			if got.String() != tt.coordinate {
+				t.Errorf("String() = %q, want %q", got.String(), tt.coordinate)
+			}
+		})
+	}
+}
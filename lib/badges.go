@@ -0,0 +1,242 @@
+// This module provides the mapping for NIP-58 badges.
+
+package lib
+
+import (
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// profileBadgesIdentifier is the d tag of a user's profile badges event.
+const profileBadgesIdentifier = "profile_badges"
+
+// ========================================
+// Badge Definition Mapper
+// ========================================
+
+// BadgeDefinitionMapper maps a kind 30009 badge definition to a Badge node
+// keyed by the definition's coordinate, linked to its issuer with an ISSUED
+// relationship. The name, description, and images of the newest definition
+// seen are set on the Badge node.
+type BadgeDefinitionMapper struct{}
+
+func (BadgeDefinitionMapper) Map(
+	event nostr.Event) (*Subgraph, []TagRejection) {
+
+	mapping := NewEventMapping(event)
+	mapping.MapTags(nil)
+
+	address := EventAddress(event)
+	if len(address.String()) > maxTagSize {
+		return mapping.Result()
+	}
+
+	badgeNode := NewBadgeNode(address)
+	issuedRel := NewIssuedRel(
+		mapping.Author,
+		badgeNode,
+		Properties{"created_at": event.CreatedAt.Time().Unix()})
+
+	mapping.Subgraph.AddNode(badgeNode)
+	mapping.Subgraph.AddRel(issuedRel)
+
+	definition := Properties{}
+	for _, field := range []string{"name", "description", "image", "thumb"} {
+		if value := tagValue(event.Tags, field); value != "" {
+			definition[field] = value
+		}
+	}
+
+	mapping.Subgraph.AddStatement(NewReplaceBadgeStatement(
+		address.String(),
+		event.ID,
+		event.CreatedAt.Time().Unix(),
+		definition,
+	))
+
+	return mapping.Result()
+}
+
+// ========================================
+// Badge Award Mapper
+// ========================================
+
+// BadgeAwardMapper maps a kind 8 badge award to AWARDED_TO relationships from
+// the awarded Badge to each awardee. Only the issuer of a badge can award it,
+// so awards of badges defined by another user are not mapped. The awarder is
+// linked to the Badge with an ISSUED relationship, so that the issuer is
+// known even if the badge definition is not imported. The relationship has
+// no properties, leaving the creation time set by the definition intact.
+type BadgeAwardMapper struct{}
+
+func (BadgeAwardMapper) Map(event nostr.Event) (*Subgraph, []TagRejection) {
+	mapping := NewEventMapping(event)
+	mapping.MapTags(nil)
+
+	address, ok := badgeAddress(tagValue(event.Tags, "a"))
+	if !ok || address.PubKey != event.PubKey {
+		return mapping.Result()
+	}
+
+	badgeNode := NewBadgeNode(address)
+	issuedRel := NewIssuedRel(mapping.Author, badgeNode, nil)
+
+	mapping.Subgraph.AddNode(badgeNode)
+	mapping.Subgraph.AddRel(issuedRel)
+
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "p" || !isHexID(tag[1]) {
+			continue
+		}
+
+		awardeeNode := NewUserNode(tag[1])
+		awardedRel := NewAwardedToRel(
+			badgeNode,
+			awardeeNode,
+			Properties{
+				"award_id":   event.ID,
+				"created_at": event.CreatedAt.Time().Unix(),
+			})
+
+		mapping.Subgraph.AddNode(awardeeNode)
+		mapping.Subgraph.AddRel(awardedRel)
+	}
+
+	return mapping.Result()
+}
+
+// ========================================
+// Profile Badges Mapper
+// ========================================
+
+// ProfileBadgesMapper maps a kind 30008 profile badges event to DISPLAYS
+// relationships from its author to each displayed Badge, in display order.
+// Badges are listed as pairs of an "a" tag for the badge and an "e" tag for
+// its award. Because profile badges are replaceable, only the newest event
+// seen for an author is applied, and applying it removes any DISPLAYS
+// relationships not present in the event.
+type ProfileBadgesMapper struct{}
+
+func (ProfileBadgesMapper) Map(event nostr.Event) (*Subgraph, []TagRejection) {
+	mapping := NewEventMapping(event)
+	mapping.MapTags(nil)
+
+	if event.Tags.GetD() != profileBadgesIdentifier {
+		return mapping.Result()
+	}
+
+	displays := []Properties{}
+	seen := NewSet[string]()
+
+	for i, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "a" || i+1 >= len(event.Tags) {
+			continue
+		}
+
+		awardTag := event.Tags[i+1]
+		if len(awardTag) < 2 || awardTag[0] != "e" || !isHexID(awardTag[1]) {
+			continue
+		}
+
+		address, ok := badgeAddress(tag[1])
+		if !ok || seen.Contains(address.String()) {
+			continue
+		}
+		seen.Add(address.String())
+
+		displays = append(displays, Properties{
+			"coordinate": address.String(),
+			"award_id":   awardTag[1],
+			"position":   len(displays),
+		})
+
+		mapping.Subgraph.AddNode(NewBadgeNode(address))
+	}
+
+	mapping.Subgraph.AddStatement(NewReplaceDisplaysStatement(
+		event.PubKey,
+		event.ID,
+		event.CreatedAt.Time().Unix(),
+		displays,
+	))
+
+	return mapping.Result()
+}
+
+// ========================================
+// Helpers
+// ========================================
+
+// badgeAddress parses the coordinate of a badge definition.
+func badgeAddress(coordinate string) (Address, bool) {
+	address, err := ParseAddress(coordinate)
+	if err != nil || address.Kind != nostr.KindBadgeDefinition {
+		return Address{}, false
+	}
+	return address, true
+}
+
+// ========================================
+// Statements
+// ========================================
+
+// replaceBadgeQuery replaces the definition fields on a badge with those of
+// its newest definition.
+var replaceBadgeQuery = newestWinsQuery(
+	"b", "Badge", "coordinate", "definition") + `
+	SET b.name = row.definition.name,
+	    b.description = row.definition.description,
+	    b.image = row.definition.image,
+	    b.thumb = row.definition.thumb
+	`
+
+// NewReplaceBadgeStatement creates a statement that sets the given definition
+// fields on a badge, if the definition is the newest seen.
+func NewReplaceBadgeStatement(
+	coordinate string,
+	id string,
+	createdAt int64,
+	definition Properties,
+) *Statement {
+	return NewStatement(replaceBadgeQuery, Properties{
+		"coordinate": coordinate,
+		"id":         id,
+		"created_at": createdAt,
+		"definition": definition,
+	})
+}
+
+// replaceDisplaysQuery replaces a user's DISPLAYS relationships with those of
+// their newest profile badges event.
+var replaceDisplaysQuery = newestWinsQuery("u", "User", "pubkey", "badges") + `
+	CALL {
+		WITH u, row
+		MATCH (u)-[r:DISPLAYS]->(b:Badge)
+		WHERE NOT b.coordinate IN [d IN row.displays | d.coordinate]
+		DELETE r
+	}
+
+	WITH u, row
+	UNWIND row.displays AS display
+	MATCH (b:Badge { coordinate: display.coordinate })
+	MERGE (u)-[r:DISPLAYS]->(b)
+	SET r.created_at = row.created_at,
+	    r.award_id = display.award_id,
+	    r.position = display.position
+	`
+
+// NewReplaceDisplaysStatement creates a statement that replaces the DISPLAYS
+// relationships of the given user with the badges of their profile badges
+// event, if the event is the newest seen.
+func NewReplaceDisplaysStatement(
+	pubkey string,
+	id string,
+	createdAt int64,
+	displays []Properties,
+) *Statement {
+	return NewStatement(replaceDisplaysQuery, Properties{
+		"pubkey":     pubkey,
+		"id":         id,
+		"created_at": createdAt,
+		"displays":   displays,
+	})
+}
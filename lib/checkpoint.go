@@ -0,0 +1,178 @@
+// This module provides checkpoints that record how far an import has
+// progressed, so that an interrupted import can be resumed without replaying
+// the batches already merged.
+
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ========================================
+// Checkpoint
+// ========================================
+
+// ErrCheckpointMismatch is returned when resuming from a checkpoint whose
+// event is not at the recorded position in the input.
+var ErrCheckpointMismatch = errors.New("checkpoint does not match input")
+
+// Checkpoint is the position in the input just past the last event of the
+// most recently merged batch. Every event before it has been merged or
+// quarantined.
+type Checkpoint struct {
+	// The name of the input source.
+	Source string `json:"source"`
+	// The byte offset in the decompressed source of the start of the event's
+	// line.
+	LineOffset int64 `json:"line_offset"`
+	// The byte offset in the decompressed source just past the event's line.
+	Offset int64 `json:"offset"`
+	// The line number of the event within the source.
+	Line int `json:"line"`
+	// The id of the event.
+	EventID string `json:"event_id"`
+}
+
+// NewCheckpoint creates a checkpoint just past the given event.
+func NewCheckpoint(event SourcedEvent) Checkpoint {
+	return Checkpoint{
+		Source:     event.Source,
+		LineOffset: event.LineOffset,
+		Offset:     event.Offset,
+		Line:       event.Line,
+		EventID:    event.Event.ID,
+	}
+}
+
+// ========================================
+// Checkpoint File
+// ========================================
+
+// CheckpointFile persists the latest checkpoint of an import to a JSON file.
+type CheckpointFile struct {
+	// The path of the file, or empty if checkpoints are not saved.
+	path string
+}
+
+// NewCheckpointFile creates a checkpoint file at the given path. If the path
+// is empty, checkpoints are discarded.
+func NewCheckpointFile(path string) *CheckpointFile {
+	return &CheckpointFile{path: path}
+}
+
+// Load reads the saved checkpoint.
+func (f *CheckpointFile) Load() (Checkpoint, error) {
+	checkpoint := Checkpoint{}
+
+	if f.path == "" {
+		return checkpoint, errors.New("no checkpoint file to resume from")
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return checkpoint, fmt.Errorf("reading checkpoint: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("parsing checkpoint %s: %w", f.path, err)
+	}
+
+	return checkpoint, nil
+}
+
+// Save replaces the saved checkpoint. The checkpoint is written to a
+// temporary file that is renamed over the previous one, so that a crash
+// leaves either the old or the new checkpoint intact.
+func (f *CheckpointFile) Save(checkpoint Checkpoint) error {
+	if f.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(f.path), ".checkpoint-*")
+	if err != nil {
+		return fmt.Errorf("saving checkpoint: %w", err)
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(append(data, '\n'))
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("saving checkpoint: %w", err)
+	}
+
+	if err := os.Rename(temp.Name(), f.path); err != nil {
+		return fmt.Errorf("saving checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// ========================================
+// Resuming
+// ========================================
+
+// ResumeSources returns the sources from the one named by the checkpoint
+// onwards. The sources before it were read completely by the interrupted
+// import.
+func ResumeSources(sources []Source, checkpoint Checkpoint) ([]Source, error) {
+	for i, source := range sources {
+		if source.Name == checkpoint.Source {
+			return sources[i:], nil
+		}
+	}
+	return nil, fmt.Errorf(
+		"checkpoint source %s is not among the inputs", checkpoint.Source)
+}
+
+// ResumeLines positions a line reader just past the line of the checkpoint.
+// The line is read again and must hold the checkpoint's event, so that an
+// input replaced since the checkpoint was saved is not silently skipped. A
+// zero checkpoint leaves the reader at the start of the input.
+func ResumeLines(lines *LineReader, checkpoint Checkpoint) error {
+	if checkpoint.Offset == 0 {
+		return nil
+	}
+
+	err := lines.Skip(checkpoint.LineOffset, checkpoint.Line-1)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrCheckpointMismatch, err)
+	}
+
+	line, err := lines.Next()
+	if err == io.EOF {
+		return fmt.Errorf("%w: input ends before line %d",
+			ErrCheckpointMismatch, checkpoint.Line)
+	}
+	if err != nil && !errors.Is(err, ErrLineTooLong) {
+		return err
+	}
+
+	event := struct {
+		ID string `json:"id"`
+	}{}
+	if err != nil ||
+		json.Unmarshal(bytes.TrimSpace(line), &event) != nil ||
+		event.ID != checkpoint.EventID ||
+		lines.Offset() != checkpoint.Offset {
+		return fmt.Errorf("%w: line %d does not hold event %s",
+			ErrCheckpointMismatch, checkpoint.Line, checkpoint.EventID)
+	}
+
+	return nil
+}
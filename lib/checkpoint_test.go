@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResumeLines(t *testing.T) {
+	a := strings.Repeat("a", 64)
+	b := strings.Repeat("b", 64)
+	first := `{"id":"` + a + `"}` + "\n"
+	second := `{"id":"` + b + `"}` + "\n"
+	input := first + second + "next\n"
+
+	atSecond := Checkpoint{
+		LineOffset: int64(len(first)),
+		Offset:     int64(len(first + second)),
+		Line:       2,
+		EventID:    b,
+	}
+
+	tests := []struct {
+		name       string
+		input      string
+		checkpoint Checkpoint
+		wantErr    bool
+	}{
+		{
+			name:       "no checkpoint",
+			input:      input,
+			checkpoint: Checkpoint{},
+		},
+		{
+			name:       "matching event",
+			input:      input,
+			checkpoint: atSecond,
+		},
+		{
+			name:       "different event",
+			input:      first + first + "next\n",
+			checkpoint: atSecond,
+			wantErr:    true,
+		},
+		{
+			name:       "shifted line",
+			input:      "\n" + input,
+			checkpoint: atSecond,
+			wantErr:    true,
+		},
+		{
+			name:       "input ends within line",
+			input:      first + second[:10],
+			checkpoint: atSecond,
+			wantErr:    true,
+		},
+		{
+			name:       "input ends at line start",
+			input:      first,
+			checkpoint: atSecond,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := NewLineReader(strings.NewReader(tt.input), 0)
+			err := ResumeLines(lines, tt.checkpoint)
+			if tt.wantErr {
+				if !errors.Is(err, ErrCheckpointMismatch) {
+					t.Errorf("got error %v, want %v", err, ErrCheckpointMismatch)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed: %s", err)
+			}
+
+			line, err := lines.Next()
+			if tt.checkpoint.Offset == 0 {
+				if string(line) != strings.TrimSuffix(first, "\n") {
+					t.Errorf("resumed at %q, want first line", line)
+				}
+				return
+			}
+			if err != nil || string(line) != "next" ||
+				lines.LineNumber() != tt.checkpoint.Line+1 {
+				t.Errorf("resumed at line %d %q, want line %d %q",
+					lines.LineNumber(), line, tt.checkpoint.Line+1, "next")
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+// This module provides the configuration of the Neo4j connection.
+//
+// Settings are resolved in the following order, with later sources taking
+// precedence over earlier ones:
+//
+//  1. The defaults returned by DefaultConfig.
+//  2. The YAML config file, if one is given.
+//  3. NEOSTR_* environment variables.
+//  4. Command-line flags.
+//
+// The config file is named by the -config flag or the NEOSTR_CONFIG
+// environment variable. The environment variables are NEOSTR_NEO4J_URI,
+// NEOSTR_NEO4J_AUTH_SCHEME, NEOSTR_NEO4J_USERNAME, NEOSTR_NEO4J_PASSWORD,
+// NEOSTR_NEO4J_TOKEN, NEOSTR_NEO4J_DATABASE, NEOSTR_NEO4J_TLS_CA_CERT,
+// NEOSTR_NEO4J_POOL_MAX_CONNECTIONS, NEOSTR_NEO4J_POOL_ACQUISITION_TIMEOUT,
+// NEOSTR_NEO4J_POOL_MAX_CONNECTION_LIFETIME, NEOSTR_NEO4J_RETRY_MAX_ATTEMPTS,
+// NEOSTR_NEO4J_RETRY_INITIAL_BACKOFF, and NEOSTR_NEO4J_RETRY_MAX_BACKOFF.
+// Durations use Go syntax, such as 30s or 1h.
+//
+// A config file has the form:
+//
+//	neo4j:
+//	  uri: neo4j+s://graph.example.com:7687
+//	  database: nostr
+//	  auth:
+//	    scheme: basic # basic, bearer, or none
+//	    username: neo4j
+//	    password: secret
+//	    token: "" # for bearer auth
+//	  tls:
+//	    ca_cert: /etc/neostr/ca.pem
+//	  pool:
+//	    max_connections: 50
+//	    acquisition_timeout: 30s
+//	    max_connection_lifetime: 1h
+//	  retry:
+//	    max_attempts: 5
+//	    initial_backoff: 500ms
+//	    max_backoff: 30s
+
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ========================================
+// Config
+// ========================================
+
+// Config is the configuration loaded from a config file and the environment.
+type Config struct {
+	// The Neo4j connection settings.
+	Neo4j Neo4jConfig `yaml:"neo4j"`
+}
+
+// Neo4jConfig configures the connection to the Neo4j database.
+type Neo4jConfig struct {
+	// The connection URI. The scheme selects encryption: neo4j+s and bolt+s
+	// verify the server certificate, and neo4j+ssc and bolt+ssc accept
+	// self-signed certificates.
+	URI string `yaml:"uri"`
+	// The authentication settings.
+	Auth AuthConfig `yaml:"auth"`
+	// The database to import into. The server's default database is used if
+	// empty.
+	Database string `yaml:"database"`
+	// The TLS settings for encrypted connections.
+	TLS TLSConfig `yaml:"tls"`
+	// The driver connection pool settings.
+	Pool PoolConfig `yaml:"pool"`
+	// The settings for retrying writes that fail with a transient error.
+	Retry RetryConfig `yaml:"retry"`
+}
+
+// AuthScheme is the method used to authenticate with Neo4j.
+type AuthScheme string
+
+const (
+	// Authenticate with a username and password.
+	AuthBasic AuthScheme = "basic"
+	// Authenticate with a bearer token, such as an SSO token.
+	AuthBearer AuthScheme = "bearer"
+	// Connect without authentication.
+	AuthNone AuthScheme = "none"
+)
+
+// AuthConfig configures authentication with Neo4j.
+type AuthConfig struct {
+	// The authentication scheme.
+	Scheme AuthScheme `yaml:"scheme"`
+	// The username for basic auth.
+	Username string `yaml:"username"`
+	// The password for basic auth.
+	Password string `yaml:"password"`
+	// The token for bearer auth.
+	Token string `yaml:"token"`
+}
+
+// TLSConfig configures encrypted connections to Neo4j.
+type TLSConfig struct {
+	// The path of a PEM file of certificate authorities to trust instead of
+	// the system certificates.
+	CACert string `yaml:"ca_cert"`
+}
+
+// PoolConfig configures the driver's connection pool. Zero values use the
+// driver's defaults.
+type PoolConfig struct {
+	// The maximum number of connections per server.
+	MaxConnections int `yaml:"max_connections"`
+	// How long to wait for a connection from the pool.
+	AcquisitionTimeout time.Duration `yaml:"acquisition_timeout"`
+	// How long a connection is kept before it is closed and replaced.
+	MaxConnectionLifetime time.Duration `yaml:"max_connection_lifetime"`
+}
+
+// RetryConfig configures how writes that fail with a transient error, such as
+// a deadlock or a leader switch, are retried. The delay before each retry
+// doubles up to the maximum, and a random jitter of up to half the delay is
+// subtracted so that concurrent writers do not retry in lockstep.
+type RetryConfig struct {
+	// The maximum number of attempts of a write, including the first.
+	MaxAttempts int `yaml:"max_attempts"`
+	// The delay before the first retry.
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	// The maximum delay between retries.
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+// Backoff returns the delay before retrying a write that has failed the given
+// number of times.
+func (c RetryConfig) Backoff(failures int) time.Duration {
+	delay := c.InitialBackoff
+	for i := 1; i < failures && delay < c.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, c.MaxBackoff)
+
+	return delay - rand.N(delay/2+1)
+}
+
+// DefaultConfig returns the configuration used when no other source sets a
+// value.
+func DefaultConfig() Config {
+	return Config{
+		Neo4j: Neo4jConfig{
+			URI: "neo4j://localhost:7687",
+			Auth: AuthConfig{
+				Scheme:   AuthBasic,
+				Username: "neo4j",
+				Password: "neo4jnostr",
+			},
+			Database: "neo4j",
+			Retry: RetryConfig{
+				MaxAttempts:    5,
+				InitialBackoff: 500 * time.Millisecond,
+				MaxBackoff:     30 * time.Second,
+			},
+		},
+	}
+}
+
+// LoadConfig returns the default configuration overridden by the config file
+// at the given path, if any, and then by NEOSTR_* environment variables.
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+
+	if path != "" {
+		if err := config.ReadFile(path); err != nil {
+			return config, err
+		}
+	}
+
+	if err := config.Neo4j.ApplyEnv(os.LookupEnv); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+// ReadFile overrides the configuration with the settings in a YAML config
+// file. Settings missing from the file are left unchanged, and unknown
+// settings are an error.
+func (c *Config) ReadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing config %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// ========================================
+// Environment
+// ========================================
+
+// ConfigPathEnv is the environment variable naming the config file.
+const ConfigPathEnv = "NEOSTR_CONFIG"
+
+// ApplyEnv overrides the configuration with the NEOSTR_NEO4J_* environment
+// variables that are set. The lookup function is usually os.LookupEnv.
+func (c *Neo4jConfig) ApplyEnv(
+	lookup func(key string) (string, bool)) error {
+
+	values := map[string]*string{
+		"NEOSTR_NEO4J_URI":         &c.URI,
+		"NEOSTR_NEO4J_USERNAME":    &c.Auth.Username,
+		"NEOSTR_NEO4J_PASSWORD":    &c.Auth.Password,
+		"NEOSTR_NEO4J_TOKEN":       &c.Auth.Token,
+		"NEOSTR_NEO4J_DATABASE":    &c.Database,
+		"NEOSTR_NEO4J_TLS_CA_CERT": &c.TLS.CACert,
+	}
+	for key, field := range values {
+		if value, ok := lookup(key); ok {
+			*field = value
+		}
+	}
+
+	if value, ok := lookup("NEOSTR_NEO4J_AUTH_SCHEME"); ok {
+		c.Auth.Scheme = AuthScheme(value)
+	}
+
+	integers := map[string]*int{
+		"NEOSTR_NEO4J_POOL_MAX_CONNECTIONS": &c.Pool.MaxConnections,
+		"NEOSTR_NEO4J_RETRY_MAX_ATTEMPTS":   &c.Retry.MaxAttempts,
+	}
+	for key, field := range integers {
+		if value, ok := lookup(key); ok {
+			integer, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", key, err)
+			}
+			*field = integer
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"NEOSTR_NEO4J_POOL_ACQUISITION_TIMEOUT":     &c.Pool.AcquisitionTimeout,
+		"NEOSTR_NEO4J_POOL_MAX_CONNECTION_LIFETIME": &c.Pool.MaxConnectionLifetime,
+		"NEOSTR_NEO4J_RETRY_INITIAL_BACKOFF":        &c.Retry.InitialBackoff,
+		"NEOSTR_NEO4J_RETRY_MAX_BACKOFF":            &c.Retry.MaxBackoff,
+	}
+	for key, field := range durations {
+		if value, ok := lookup(key); ok {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", key, err)
+			}
+			*field = duration
+		}
+	}
+
+	return nil
+}
+
+// ========================================
+// Validation
+// ========================================
+
+// Validate reports whether the configuration is complete and consistent.
+func (c *Neo4jConfig) Validate() error {
+	if c.URI == "" {
+		return fmt.Errorf("neo4j uri is required")
+	}
+
+	switch c.Auth.Scheme {
+	case AuthBasic:
+		if c.Auth.Username == "" {
+			return fmt.Errorf("neo4j username is required for basic auth")
+		}
+	case AuthBearer:
+		if c.Auth.Token == "" {
+			return fmt.Errorf("neo4j token is required for bearer auth")
+		}
+	case AuthNone:
+	default:
+		return fmt.Errorf("unknown neo4j auth scheme: %q", c.Auth.Scheme)
+	}
+
+	if c.Pool.MaxConnections < 0 ||
+		c.Pool.AcquisitionTimeout < 0 ||
+		c.Pool.MaxConnectionLifetime < 0 {
+		return fmt.Errorf("neo4j pool settings must not be negative")
+	}
+
+	if c.Retry.MaxAttempts < 1 {
+		return fmt.Errorf("neo4j retry max attempts must be at least 1")
+	}
+
+	if c.Retry.InitialBackoff < 0 || c.Retry.MaxBackoff < 0 {
+		return fmt.Errorf("neo4j retry backoff must not be negative")
+	}
+
+	return nil
+}
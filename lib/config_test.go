@@ -0,0 +1,262 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file with the given contents to a temporary
+// directory and returns its path.
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// clearConfigEnv unsets the NEOSTR_* environment variables for the duration
+// of the test.
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+
+	for _, entry := range os.Environ() {
+		key, _, _ := strings.Cut(entry, "=")
+		if strings.HasPrefix(key, "NEOSTR_") {
+			t.Setenv(key, "")
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	file := `
+neo4j:
+  uri: neo4j://file.example.com:7687
+  database: nostr
+  auth:
+    username: file-user
+  retry:
+    max_attempts: 3
+    max_backoff: 10s
+`
+
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		want    func(*Neo4jConfig)
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: func(c *Neo4jConfig) {},
+		},
+		{
+			name: "file overrides defaults",
+			file: file,
+			want: func(c *Neo4jConfig) {
+				c.URI = "neo4j://file.example.com:7687"
+				c.Database = "nostr"
+				c.Auth.Username = "file-user"
+				c.Retry.MaxAttempts = 3
+				c.Retry.MaxBackoff = 10 * time.Second
+			},
+		},
+		{
+			name: "env overrides file",
+			file: file,
+			env: map[string]string{
+				"NEOSTR_NEO4J_URI":                "neo4j://env.example.com:7687",
+				"NEOSTR_NEO4J_RETRY_MAX_ATTEMPTS": "7",
+				"NEOSTR_NEO4J_RETRY_MAX_BACKOFF":  "1m",
+				"NEOSTR_NEO4J_DATABASE":           "",
+			},
+			want: func(c *Neo4jConfig) {
+				c.URI = "neo4j://env.example.com:7687"
+				c.Database = ""
+				c.Auth.Username = "file-user"
+				c.Retry.MaxAttempts = 7
+				c.Retry.MaxBackoff = time.Minute
+			},
+		},
+		{
+			name:    "unknown key in file",
+			file:    "neo4j:\n  url: neo4j://file.example.com:7687\n",
+			wantErr: true,
+		},
+		{
+			name:    "malformed file",
+			file:    "neo4j: [",
+			wantErr: true,
+		},
+		{
+			name:    "invalid duration in file",
+			file:    "neo4j:\n  retry:\n    max_backoff: soon\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid integer in env",
+			env:     map[string]string{"NEOSTR_NEO4J_RETRY_MAX_ATTEMPTS": "five"},
+			wantErr: true,
+		},
+		{
+			name: "invalid duration in env",
+			env: map[string]string{
+				"NEOSTR_NEO4J_POOL_ACQUISITION_TIMEOUT": "30",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearConfigEnv(t)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			path := ""
+			if tt.file != "" {
+				path = writeConfig(t, tt.file)
+			}
+
+			config, err := LoadConfig(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("LoadConfig() = %+v, want error", config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig() failed: %s", err)
+			}
+
+			want := DefaultConfig().Neo4j
+			tt.want(&want)
+			if config.Neo4j != want {
+				t.Errorf("LoadConfig() = %+v, want %+v", config.Neo4j, want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	clearConfigEnv(t)
+
+	path := filepath.Join(t.TempDir(), "missing.yaml")
+	if _, err := LoadConfig(path); err == nil {
+		t.Errorf("LoadConfig(%q) succeeded, want error", path)
+	}
+}
+
+func TestNeo4jConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(*Neo4jConfig)
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			edit: func(c *Neo4jConfig) {},
+		},
+		{
+			name:    "missing uri",
+			edit:    func(c *Neo4jConfig) { c.URI = "" },
+			wantErr: true,
+		},
+		{
+			name: "bearer with token",
+			edit: func(c *Neo4jConfig) {
+				c.Auth.Scheme = AuthBearer
+				c.Auth.Token = "token"
+			},
+		},
+		{
+			name:    "bearer without token",
+			edit:    func(c *Neo4jConfig) { c.Auth.Scheme = AuthBearer },
+			wantErr: true,
+		},
+		{
+			name:    "basic without username",
+			edit:    func(c *Neo4jConfig) { c.Auth.Username = "" },
+			wantErr: true,
+		},
+		{
+			name: "no auth",
+			edit: func(c *Neo4jConfig) {
+				c.Auth = AuthConfig{Scheme: AuthNone}
+			},
+		},
+		{
+			name:    "unknown scheme",
+			edit:    func(c *Neo4jConfig) { c.Auth.Scheme = "kerberos" },
+			wantErr: true,
+		},
+		{
+			name:    "negative pool size",
+			edit:    func(c *Neo4jConfig) { c.Pool.MaxConnections = -1 },
+			wantErr: true,
+		},
+		{
+			name:    "no attempts",
+			edit:    func(c *Neo4jConfig) { c.Retry.MaxAttempts = 0 },
+			wantErr: true,
+		},
+		{
+			name:    "negative backoff",
+			edit:    func(c *Neo4jConfig) { c.Retry.InitialBackoff = -time.Second },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig().Neo4j
+			tt.edit(&config)
+
+			err := config.Validate()
+			if tt.wantErr && err == nil {
+				t.Errorf("Validate() succeeded, want error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Validate() failed: %s", err)
+			}
+		})
+	}
+}
+
+func TestRetryConfigBackoff(t *testing.T) {
+	config := RetryConfig{
+		MaxAttempts:    10,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+	}
+
+	tests := []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{1, 500 * time.Millisecond},
+		{2, time.Second},
+		{3, 2 * time.Second},
+		{4, 4 * time.Second},
+		{5, 5 * time.Second},
+		{20, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		for range 100 {
+			got := config.Backoff(tt.failures)
+			if got < tt.delay/2 || got > tt.delay || got > config.MaxBackoff {
+				t.Fatalf("Backoff(%d) = %s, want within [%s, %s]",
+					tt.failures, got, tt.delay/2, tt.delay)
+			}
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// This module provides the connection to the Neo4j database that events are
+// merged into.
+
+package lib
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// ========================================
+// Database
+// ========================================
+
+// Database is a Neo4j driver bound to the database that queries run against.
+type Database struct {
+	// The Neo4j driver.
+	driver neo4j.DriverWithContext
+	// The name of the target database, or empty for the server's default.
+	name string
+	// The settings for retrying writes that fail with a transient error.
+	retry RetryConfig
+}
+
+// ExecuteQuery runs a query against the target database and returns its
+// eagerly collected result.
+func (db *Database) ExecuteQuery(
+	ctx context.Context,
+	query string,
+	params map[string]any,
+) (*neo4j.EagerResult, error) {
+	return neo4j.ExecuteQuery(ctx, db.driver,
+		query,
+		params,
+		neo4j.EagerResultTransformer,
+		neo4j.ExecuteQueryWithDatabase(db.name))
+}
+
+// ExecuteWrite runs a write query against the target database in a managed
+// transaction and returns its summary. Transient failures, such as deadlocks
+// and leader switches, are retried with backoff until the configured number
+// of attempts is reached.
+func (db *Database) ExecuteWrite(
+	ctx context.Context,
+	query string,
+	params map[string]any,
+) (neo4j.ResultSummary, error) {
+	session := db.driver.NewSession(ctx, neo4j.SessionConfig{
+		AccessMode:   neo4j.AccessModeWrite,
+		DatabaseName: db.name,
+	})
+	defer session.Close(ctx)
+
+	for attempt := 1; ; attempt++ {
+		summary, err := neo4j.ExecuteWrite(ctx, session,
+			func(tx neo4j.ManagedTransaction) (neo4j.ResultSummary, error) {
+				result, err := tx.Run(ctx, query, params)
+				if err != nil {
+					return nil, err
+				}
+				return result.Consume(ctx)
+			})
+		if err == nil || !IsTransient(err) || attempt >= db.retry.MaxAttempts {
+			return summary, err
+		}
+
+		delay := db.retry.Backoff(attempt)
+		log.Printf("Retrying write in %s after attempt %d failed: %s\n",
+			delay, attempt, err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// IsTransient reports whether a failed write may succeed if it is retried.
+func IsTransient(err error) bool {
+	// The driver's own retries are disabled, so it gives up on the first
+	// failure it would have retried and reports it as an execution limit.
+	var limit *neo4j.TransactionExecutionLimit
+	if errors.As(err, &limit) {
+		return true
+	}
+	return neo4j.IsRetryable(err)
+}
+
+// IsDataError reports whether a failed write may have been caused by the data
+// it was writing, such as an invalid property value or a constraint
+// violation, rather than by the database, the connection or the credentials.
+func IsDataError(err error) bool {
+	code := neo4jErrorCode(err)
+	return strings.HasPrefix(code, "Neo.ClientError.Statement.") ||
+		strings.HasPrefix(code, "Neo.ClientError.Schema.")
+}
+
+// outOfMemoryCodes are the codes of the errors reported when a transaction
+// does not fit in the memory available to it.
+var outOfMemoryCodes = map[string]bool{
+	"Neo.TransientError.General.MemoryPoolOutOfMemoryError": true,
+	"Neo.TransientError.General.OutOfMemoryError":           true,
+	"Neo.TransientError.General.TransactionMemoryLimit":     true,
+}
+
+// IsOutOfMemory reports whether a failed write ran out of memory, which a
+// smaller write may avoid.
+func IsOutOfMemory(err error) bool {
+	return outOfMemoryCodes[neo4jErrorCode(err)]
+}
+
+// neo4jErrorCode returns the status code of the error reported by the server
+// for a failed write, or an empty string if the server reported none. When
+// the write was attempted more than once, the last attempt's error is used.
+func neo4jErrorCode(err error) string {
+	var limit *neo4j.TransactionExecutionLimit
+	if errors.As(err, &limit) && len(limit.Errors) > 0 {
+		err = limit.Errors[len(limit.Errors)-1]
+	}
+
+	var neo4jErr *neo4j.Neo4jError
+	if errors.As(err, &neo4jErr) {
+		return neo4jErr.Code
+	}
+	return ""
+}
+
+// Close closes the driver and its connections.
+func (db *Database) Close(ctx context.Context) error {
+	return db.driver.Close(ctx)
+}
+
+// ========================================
+// Connection
+// ========================================
+
+// indexQueries create the indexes and constraints that merges rely on.
+var indexQueries = []string{
+	`CREATE CONSTRAINT user_pubkey IF NOT EXISTS
+	 FOR (n:User) REQUIRE n.pubkey IS UNIQUE`,
+
+	`CREATE INDEX user_pubkey IF NOT EXISTS
+	 FOR (n:User) ON (n.pubkey)`,
+
+	`CREATE INDEX relay_url IF NOT EXISTS
+	 FOR (n:Relay) ON (n.url)`,
+
+	`CREATE INDEX event_id IF NOT EXISTS
+	 FOR (n:Event) ON (n.id)`,
+
+	`CREATE INDEX event_kind IF NOT EXISTS
+	 FOR (n:Event) ON (n.kind)`,
+
+	`CREATE INDEX tag_name_value IF NOT EXISTS
+	 FOR (n:Tag) ON (n.name, n.value)`,
+
+	`CREATE INDEX address_coordinate IF NOT EXISTS
+	 FOR (n:Address) ON (n.coordinate)`,
+
+	`CREATE INDEX hashtag_name IF NOT EXISTS
+	 FOR (n:Hashtag) ON (n.name)`,
+
+	`CREATE INDEX label_namespace_value IF NOT EXISTS
+	 FOR (n:Label) ON (n.namespace, n.value)`,
+
+	`CREATE INDEX badge_coordinate IF NOT EXISTS
+	 FOR (n:Badge) ON (n.coordinate)`,
+}
+
+// connectNeo4j connects to the configured Neo4j database and creates its
+// indexes and constraints.
+func connectNeo4j(ctx context.Context, config Neo4jConfig) (*Database, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	auth, err := neo4jAuth(config.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := neo4jTLS(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := neo4j.NewDriverWithContext(
+		config.URI,
+		auth,
+		func(c *neo4j.Config) {
+			c.TlsConfig = tlsConfig
+			// Writes are retried by ExecuteWrite instead
+			c.MaxTransactionRetryTime = 0
+			if config.Pool.MaxConnections > 0 {
+				c.MaxConnectionPoolSize = config.Pool.MaxConnections
+			}
+			if config.Pool.AcquisitionTimeout > 0 {
+				c.ConnectionAcquisitionTimeout = config.Pool.AcquisitionTimeout
+			}
+			if config.Pool.MaxConnectionLifetime > 0 {
+				c.MaxConnectionLifetime = config.Pool.MaxConnectionLifetime
+			}
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	db := &Database{
+		driver: driver,
+		name:   config.Database,
+		retry:  config.Retry,
+	}
+
+	err = driver.VerifyConnectivity(ctx)
+	if err != nil {
+		db.Close(ctx)
+		return nil, err
+	}
+
+	// Create indexes/constraints
+	for _, query := range indexQueries {
+		_, err = db.ExecuteQuery(ctx, query, nil)
+		if err != nil {
+			db.Close(ctx)
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// neo4jAuth returns the auth token for the configured auth scheme.
+func neo4jAuth(config AuthConfig) (neo4j.AuthToken, error) {
+	switch config.Scheme {
+	case AuthBasic:
+		return neo4j.BasicAuth(config.Username, config.Password, ""), nil
+	case AuthBearer:
+		return neo4j.BearerAuth(config.Token), nil
+	case AuthNone:
+		return neo4j.NoAuth(), nil
+	}
+	return neo4j.AuthToken{}, fmt.Errorf(
+		"unknown neo4j auth scheme: %q", config.Scheme)
+}
+
+// neo4jTLS returns the TLS configuration for encrypted connections, or nil to
+// use the driver's defaults.
+func neo4jTLS(config TLSConfig) (*tls.Config, error) {
+	if config.CACert == "" {
+		return nil, nil
+	}
+
+	pem, err := os.ReadFile(config.CACert)
+	if err != nil {
+		return nil, fmt.Errorf("reading neo4j ca cert: %w", err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf(
+			"no certificates found in neo4j ca cert: %s", config.CACert)
+	}
+
+	return &tls.Config{
+		RootCAs:    roots,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
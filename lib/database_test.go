@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func TestMergeErrorClassification(t *testing.T) {
+	serverError := func(code string) error {
+		return &neo4j.Neo4jError{Code: code}
+	}
+
+	tests := []struct {
+		name        string
+		err         error
+		data        bool
+		outOfMemory bool
+	}{
+		{
+			name: "invalid property value",
+			err:  serverError("Neo.ClientError.Statement.TypeError"),
+			data: true,
+		},
+		{
+			name: "constraint violation",
+			err:  serverError("Neo.ClientError.Schema.ConstraintValidationFailed"),
+			data: true,
+		},
+		{
+			name: "wrapped data error",
+			err: fmt.Errorf("merging: %w",
+				serverError("Neo.ClientError.Statement.ArgumentError")),
+			data: true,
+		},
+		{
+			name: "expired token",
+			err:  serverError("Neo.ClientError.Security.TokenExpired"),
+		},
+		{
+			name: "forbidden",
+			err:  serverError("Neo.ClientError.Security.Forbidden"),
+		},
+		{
+			name: "database error",
+			err:  serverError("Neo.DatabaseError.General.UnknownError"),
+		},
+		{
+			name: "deadlock",
+			err:  serverError("Neo.TransientError.Transaction.DeadlockDetected"),
+		},
+		{
+			name: "connection error",
+			err:  errors.New("connection refused"),
+		},
+		{
+			name: "memory pool exhausted",
+			err: serverError(
+				"Neo.TransientError.General.MemoryPoolOutOfMemoryError"),
+			outOfMemory: true,
+		},
+		{
+			name: "memory error after retries",
+			err: &neo4j.TransactionExecutionLimit{Errors: []error{
+				serverError("Neo.TransientError.Transaction.DeadlockDetected"),
+				serverError("Neo.TransientError.General.TransactionMemoryLimit"),
+			}},
+			outOfMemory: true,
+		},
+		{
+			name: "execution limit without errors",
+			err:  &neo4j.TransactionExecutionLimit{Cause: "timeout"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsDataError(tt.err); got != tt.data {
+				t.Errorf("IsDataError() = %v, want %v", got, tt.data)
+			}
+			if got := IsOutOfMemory(tt.err); got != tt.outOfMemory {
+				t.Errorf("IsOutOfMemory() = %v, want %v", got, tt.outOfMemory)
+			}
+		})
+	}
+}
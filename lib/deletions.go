@@ -0,0 +1,153 @@
+// This module provides the mapping for NIP-09 deletion requests.
+
+package lib
+
+import (
+	"fmt"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ========================================
+// Deletion Policy
+// ========================================
+
+// DeletionPolicy determines how a deletion request is applied to its target.
+type DeletionPolicy string
+
+const (
+	// Deleted events are marked deleted and otherwise left intact.
+	DeletionMark DeletionPolicy = "mark"
+	// Deleted events are marked deleted and their content is removed.
+	DeletionPurge DeletionPolicy = "purge"
+)
+
+// ParseDeletionPolicy returns the deletion policy with the given name.
+func ParseDeletionPolicy(name string) (DeletionPolicy, error) {
+	switch policy := DeletionPolicy(name); policy {
+	case DeletionMark, DeletionPurge:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown deletion policy: %q", name)
+}
+
+// ========================================
+// Deletion Mapper
+// ========================================
+
+// DeletionMapper maps a kind 5 deletion request to DELETES relationships from
+// the request to each event it targets by "e" tag and each address it targets
+// by "a" tag. An event deletion is applied only if the target was signed by
+// the author of the request. An address deletion is mapped only if the
+// address belongs to the author of the request, and applies to every revision
+// of the address created at or before the request. Targets that have not been
+// imported yet keep the DELETES relationship, and the deletion is applied
+// when they are.
+type DeletionMapper struct {
+	// How deletions are applied to their targets.
+	Policy DeletionPolicy
+}
+
+func (m DeletionMapper) Map(event nostr.Event) (*Subgraph, []TagRejection) {
+	mapping := NewEventMapping(event)
+
+	deletesProps := Properties{
+		"created_at": event.CreatedAt.Time().Unix(),
+		"purge":      m.Policy == DeletionPurge,
+	}
+
+	mapping.MapTags(func(tag nostr.Tag) bool {
+		switch tag[0] {
+		case "e":
+			if !isHexID(tag[1]) {
+				return false
+			}
+
+			targetNode := NewEventNode(tag[1])
+			deletesRel := NewDeletesRel(
+				mapping.EventNode, targetNode, deletesProps)
+
+			mapping.Subgraph.AddNode(targetNode)
+			mapping.Subgraph.AddRel(deletesRel)
+			mapping.Subgraph.AddStatement(NewApplyDeletionsStatement(tag[1]))
+			return true
+
+		case "a":
+			address, err := ParseAddress(tag[1])
+			if err != nil || address.PubKey != event.PubKey {
+				return false
+			}
+
+			targetNode := NewAddressNode(address)
+			deletesRel := NewDeletesAddressRel(
+				mapping.EventNode, targetNode, deletesProps)
+
+			mapping.Subgraph.AddNode(targetNode)
+			mapping.Subgraph.AddRel(deletesRel)
+			mapping.Subgraph.AddStatement(
+				NewApplyAddressDeletionsStatement(address.String()))
+			return true
+		}
+
+		return false
+	})
+
+	return mapping.Result()
+}
+
+// ========================================
+// Statements
+// ========================================
+
+// applyDeletionsQuery applies the deletion requests targeting each event.
+// Requests whose author did not sign the target have their DELETES
+// relationship removed. Targets that have not been imported yet have no
+// author and are left for when they are.
+const applyDeletionsQuery = `
+	UNWIND $rows AS row
+	WITH DISTINCT row.target AS id
+
+	MATCH (target:Event { id: id })<-[r:DELETES]-(deletion:Event)
+	MATCH (author:User)-[:SIGNED]->(target)
+	MATCH (deleter:User)-[:SIGNED]->(deletion)
+	WITH target, r, author = deleter AS authorized
+
+	CALL {
+		WITH r, authorized
+		WITH r WHERE NOT authorized
+		DELETE r
+	}
+
+	WITH target, r WHERE authorized
+	SET target.deleted = true,
+	    target.content = CASE WHEN r.purge THEN null ELSE target.content END
+	`
+
+// NewApplyDeletionsStatement creates a statement that applies any deletion
+// requests targeting the given event.
+func NewApplyDeletionsStatement(target string) *Statement {
+	return NewStatement(applyDeletionsQuery, Properties{"target": target})
+}
+
+// applyAddressDeletionsQuery applies the deletion requests targeting each
+// address to the revisions of the address created at or before the request.
+// Only requests by the address's author are mapped, so no further check is
+// needed.
+const applyAddressDeletionsQuery = `
+	UNWIND $rows AS row
+	WITH DISTINCT row.coordinate AS coordinate
+
+	MATCH (a:Address { coordinate: coordinate })<-[r:DELETES]-(:Event)
+	MATCH (e:Event)-[v:VERSION_OF]->(a)
+	WHERE v.created_at <= r.created_at
+	SET e.deleted = true,
+	    e.content = CASE WHEN r.purge THEN null ELSE e.content END
+	`
+
+// NewApplyAddressDeletionsStatement creates a statement that applies any
+// deletion requests targeting the given address.
+func NewApplyAddressDeletionsStatement(coordinate string) *Statement {
+	return NewStatement(applyAddressDeletionsQuery, Properties{
+		"coordinate": coordinate,
+	})
+}
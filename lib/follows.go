@@ -0,0 +1,97 @@
+// This module provides the mapping for NIP-02 follow lists.
+
+package lib
+
+import (
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ========================================
+// Follow List Mapper
+// ========================================
+
+// FollowListMapper maps a kind 3 follow list to FOLLOWS relationships from its
+// author to each followed user. Because follow lists are replaceable, only the
+// newest list seen for an author is applied, and applying it removes any
+// FOLLOWS relationships not present in the list.
+type FollowListMapper struct{}
+
+func (FollowListMapper) Map(event nostr.Event) (*Subgraph, []TagRejection) {
+	mapping := NewEventMapping(event)
+
+	follows := []Properties{}
+	seen := NewSet[string]()
+
+	mapping.MapTags(func(tag nostr.Tag) bool {
+		if tag[0] != "p" || !isHexID(tag[1]) {
+			return false
+		}
+
+		pubkey := tag[1]
+		if seen.Contains(pubkey) {
+			return true
+		}
+		seen.Add(pubkey)
+
+		follow := Properties{"pubkey": pubkey}
+		if len(tag) > 2 && tag[2] != "" {
+			follow["relay"] = tag[2]
+		}
+		if len(tag) > 3 && tag[3] != "" {
+			follow["petname"] = tag[3]
+		}
+		follows = append(follows, follow)
+
+		mapping.Subgraph.AddNode(NewUserNode(pubkey))
+		return true
+	})
+
+	mapping.Subgraph.AddStatement(NewReplaceFollowsStatement(
+		event.PubKey,
+		event.ID,
+		event.CreatedAt.Time().Unix(),
+		follows,
+	))
+
+	return mapping.Result()
+}
+
+// ========================================
+// Statements
+// ========================================
+
+// replaceFollowsQuery replaces a user's FOLLOWS relationships with those of
+// their newest follow list.
+var replaceFollowsQuery = newestWinsQuery("u", "User", "pubkey", "follows") + `
+	CALL {
+		WITH u, row
+		MATCH (u)-[r:FOLLOWS]->(f:User)
+		WHERE NOT f.pubkey IN [follow IN row.follows | follow.pubkey]
+		DELETE r
+	}
+
+	WITH u, row
+	UNWIND row.follows AS follow
+	MATCH (f:User { pubkey: follow.pubkey })
+	MERGE (u)-[r:FOLLOWS]->(f)
+	SET r.created_at = row.created_at,
+	    r.relay = follow.relay,
+	    r.petname = follow.petname
+	`
+
+// NewReplaceFollowsStatement creates a statement that replaces the FOLLOWS
+// relationships of the given user with the follows of their follow list, if
+// the list is the newest seen.
+func NewReplaceFollowsStatement(
+	pubkey string,
+	id string,
+	createdAt int64,
+	follows []Properties,
+) *Statement {
+	return NewStatement(replaceFollowsQuery, Properties{
+		"pubkey":     pubkey,
+		"id":         id,
+		"created_at": createdAt,
+		"follows":    follows,
+	})
+}
@@ -4,6 +4,7 @@
 package lib
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
@@ -13,6 +14,16 @@ import (
 // Types
 // ========================================
 
+// ErrInvalidNode is returned when a node cannot be matched in the database.
+var ErrInvalidNode = errors.New("invalid node")
+
+// ErrInvalidRelationship is returned when a relationship's start or end node
+// is invalid or does not have the label its type requires.
+var ErrInvalidRelationship = errors.New("invalid relationship")
+
+// ErrInvalidSortKey is returned when a serialized sort key is malformed.
+var ErrInvalidSortKey = errors.New("invalid sort key")
+
 // Properties represents a map of node or relationship props.
 type Properties map[string]any
 
@@ -133,6 +144,10 @@ type Relationship struct {
 	End *Node
 	// Mapping of properties on the relationship
 	Props Properties
+	// The label required on the start node, if any.
+	StartLabel string
+	// The label required on the end node, if any.
+	EndLabel string
 }
 
 // NewRelationship creates a new relationship with the given type, start node,
@@ -151,6 +166,22 @@ func NewRelationship(
 	}
 }
 
+// Validate returns an error if the start or end node is missing the label
+// required by the relationship.
+func (r *Relationship) Validate() error {
+	if r.StartLabel != "" {
+		if err := validateNodeLabel(r.Start, "start", r.StartLabel); err != nil {
+			return err
+		}
+	}
+	if r.EndLabel != "" {
+		if err := validateNodeLabel(r.End, "end", r.EndLabel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type SerializedRel = map[string]Properties
 
 func (r *Relationship) Serialize() *SerializedRel {
@@ -161,6 +192,60 @@ func (r *Relationship) Serialize() *SerializedRel {
 	return &srel
 }
 
+// ========================================
+// Statements
+// ========================================
+
+// Statement represents one row of a parameterized Cypher query that is run
+// after a batch's nodes and relationships have been merged. Statements are
+// used for conditional writes that cannot be expressed as a plain merge.
+type Statement struct {
+	// The Cypher query. Rows of statements sharing a query are run together
+	// and bound to the $rows parameter.
+	Query string
+	// The parameters for this row.
+	Row Properties
+}
+
+// NewStatement creates a new statement with the given query and row.
+func NewStatement(query string, row Properties) *Statement {
+	if row == nil {
+		row = make(Properties)
+	}
+	return &Statement{
+		Query: query,
+		Row:   row,
+	}
+}
+
+// newestWinsQuery returns the head of a statement query for a replaceable
+// event whose newest version wins. The rows of a batch are grouped by their
+// key property, and only the newest row of each group is kept. The row is
+// then applied to the node with the given label and key only if it is newer
+// than the event last applied to it, with ties broken by the lowest event id
+// as in NIP-01. The applied event is recorded in the node's
+// <prefix>_created_at and <prefix>_event_id properties. The query continues
+// with the node bound to variable and the newest row bound to row, so that
+// the caller can append the writes that apply the row.
+func newestWinsQuery(variable, label, key, prefix string) string {
+	return fmt.Sprintf(`
+	UNWIND $rows AS row
+	WITH row ORDER BY row.created_at DESC, row.id ASC
+	WITH row.%[3]s AS key, collect(row)[0] AS row
+
+	MATCH (%[1]s:%[2]s { %[3]s: key })
+	WHERE %[1]s.%[4]s_created_at IS NULL
+	   OR row.created_at > %[1]s.%[4]s_created_at
+	   OR (row.created_at = %[1]s.%[4]s_created_at
+	       AND row.id <= %[1]s.%[4]s_event_id)
+	SET %[1]s.%[4]s_created_at = row.created_at,
+	    %[1]s.%[4]s_event_id = row.id
+
+	WITH %[1]s, row
+	`,
+		variable, label, key, prefix)
+}
+
 // ========================================
 // Simple Subgraph
 // ========================================
@@ -171,13 +256,16 @@ type Subgraph struct {
 	nodes []*Node
 	// The relationships in the subgraph.
 	rels []*Relationship
+	// The statements to run after the subgraph is merged.
+	statements []*Statement
 }
 
 // NewSubgraph creates an empty subgraph.
 func NewSubgraph() *Subgraph {
 	return &Subgraph{
-		nodes: []*Node{},
-		rels:  []*Relationship{},
+		nodes:      []*Node{},
+		rels:       []*Relationship{},
+		statements: []*Statement{},
 	}
 }
 
@@ -191,6 +279,11 @@ func (s *Subgraph) AddRel(rel *Relationship) {
 	s.rels = append(s.rels, rel)
 }
 
+// AddStatement adds a statement to the subgraph.
+func (s *Subgraph) AddStatement(statement *Statement) {
+	s.statements = append(s.statements, statement)
+}
+
 // ========================================
 // Structured Subgraph
 // ========================================
@@ -203,65 +296,139 @@ type StructuredSubgraph struct {
 	// A map of grouped relationships, sorted by their type and related node
 	// labels.
 	rels map[string][]*Relationship
+	// A map of statement rows, grouped by their query.
+	statements map[string][]Properties
+	// The statement queries in the order they were first added.
+	queries []string
 	// Provides node property keys used to match nodes with given labels in the
 	// database.
 	matchProvider MatchKeysProvider
+	// Provides relationship property keys used to distinguish relationships
+	// of a given type between the same pair of nodes.
+	relMatchProvider MatchKeysProvider
 }
 
 // NewStructuredSubgraph creates an empty structured subgraph with the given
-// match keys provider.
-func NewStructuredSubgraph(matchProvider MatchKeysProvider) *StructuredSubgraph {
+// node and relationship match keys providers.
+func NewStructuredSubgraph(
+	matchProvider MatchKeysProvider,
+	relMatchProvider MatchKeysProvider,
+) *StructuredSubgraph {
 	return &StructuredSubgraph{
-		nodes:         make(map[string][]*Node),
-		rels:          make(map[string][]*Relationship),
-		matchProvider: matchProvider,
+		nodes:            make(map[string][]*Node),
+		rels:             make(map[string][]*Relationship),
+		statements:       make(map[string][]Properties),
+		queries:          []string{},
+		matchProvider:    matchProvider,
+		relMatchProvider: relMatchProvider,
 	}
 }
 
-// AddNode sorts a node into the subgraph.
-func (s *StructuredSubgraph) AddNode(node *Node) {
+// AddNode sorts a node into the subgraph. Returns an error wrapping
+// ErrInvalidNode if the node is missing its match properties.
+func (s *StructuredSubgraph) AddNode(node *Node) error {
+	sortKey, err := s.nodeSortKey(node)
+	if err != nil {
+		return err
+	}
 
-	// Verify that the node has defined match property values.
-	matchLabel, _, err := node.MatchProps(s.matchProvider)
+	// Add the node to the subgraph.
+	s.nodes[sortKey] = append(s.nodes[sortKey], node)
+	return nil
+}
+
+// AddRel sorts a relationship into the subgraph. Returns an error wrapping
+// ErrInvalidRelationship if the relationship's nodes are invalid.
+func (s *StructuredSubgraph) AddRel(rel *Relationship) error {
+	sortKey, err := s.relSortKey(rel)
 	if err != nil {
-		panic(fmt.Errorf("invalid node: %s", err))
+		return err
 	}
 
-	// Determine the node's sort key.
-	sortKey := createNodeSortKey(matchLabel, node.Labels.ToArray())
+	// Add the relationship to the subgraph.
+	s.rels[sortKey] = append(s.rels[sortKey], rel)
+	return nil
+}
 
-	if _, exists := s.nodes[sortKey]; !exists {
-		s.nodes[sortKey] = []*Node{}
+// AddSubgraph sorts all nodes, relationships, and statements of a simple
+// subgraph into the structured subgraph. If any node or relationship is
+// invalid, nothing is added and the error is returned.
+func (s *StructuredSubgraph) AddSubgraph(subgraph *Subgraph) error {
+	nodeKeys := make([]string, len(subgraph.nodes))
+	for i, node := range subgraph.nodes {
+		sortKey, err := s.nodeSortKey(node)
+		if err != nil {
+			return err
+		}
+		nodeKeys[i] = sortKey
 	}
 
-	// Add the node to the subgraph.
-	s.nodes[sortKey] = append(s.nodes[sortKey], node)
+	relKeys := make([]string, len(subgraph.rels))
+	for i, rel := range subgraph.rels {
+		sortKey, err := s.relSortKey(rel)
+		if err != nil {
+			return err
+		}
+		relKeys[i] = sortKey
+	}
+
+	for i, node := range subgraph.nodes {
+		s.nodes[nodeKeys[i]] = append(s.nodes[nodeKeys[i]], node)
+	}
+	for i, rel := range subgraph.rels {
+		s.rels[relKeys[i]] = append(s.rels[relKeys[i]], rel)
+	}
+	for _, statement := range subgraph.statements {
+		s.AddStatement(statement)
+	}
+
+	return nil
 }
 
-// AddRel sorts a relationship into the subgraph.
-func (s *StructuredSubgraph) AddRel(rel *Relationship) {
+// nodeSortKey verifies that the node has defined match property values and
+// returns its sort key.
+func (s *StructuredSubgraph) nodeSortKey(node *Node) (string, error) {
+	matchLabel, _, err := node.MatchProps(s.matchProvider)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidNode, err)
+	}
+
+	return createNodeSortKey(matchLabel, node.Labels.ToArray()), nil
+}
+
+// relSortKey verifies that the relationship's start and end nodes have the
+// required labels and defined match property values, and returns its sort
+// key.
+func (s *StructuredSubgraph) relSortKey(rel *Relationship) (string, error) {
+	if err := rel.Validate(); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidRelationship, err)
+	}
 
 	// Verify that the start node has defined match property values.
 	startLabel, _, err := rel.Start.MatchProps(s.matchProvider)
 	if err != nil {
-		panic(fmt.Errorf("invalid start node: %s", err))
+		return "", fmt.Errorf(
+			"%w: invalid start node: %w", ErrInvalidRelationship, err)
 	}
 
 	// Verify that the end node has defined match property values.
 	endLabel, _, err := rel.End.MatchProps(s.matchProvider)
 	if err != nil {
-		panic(fmt.Errorf("invalid end node: %s", err))
+		return "", fmt.Errorf(
+			"%w: invalid end node: %w", ErrInvalidRelationship, err)
 	}
 
-	// Determine the relationship's sort key.
-	sortKey := createRelSortKey(rel.Type, startLabel, endLabel)
+	return createRelSortKey(rel.Type, startLabel, endLabel), nil
+}
 
-	if _, exists := s.rels[sortKey]; !exists {
-		s.rels[sortKey] = []*Relationship{}
+// AddStatement groups a statement's row under its query.
+func (s *StructuredSubgraph) AddStatement(statement *Statement) {
+	if _, exists := s.statements[statement.Query]; !exists {
+		s.queries = append(s.queries, statement.Query)
 	}
 
-	// Add the relationship to the subgraph.
-	s.rels[sortKey] = append(s.rels[sortKey], rel)
+	s.statements[statement.Query] = append(
+		s.statements[statement.Query], statement.Row)
 }
 
 // GetNodes returns the nodes grouped under the given sort key.
@@ -274,6 +441,11 @@ func (s *StructuredSubgraph) GetRels(relKey string) []*Relationship {
 	return s.rels[relKey]
 }
 
+// GetStatementRows returns the statement rows grouped under the given query.
+func (s *StructuredSubgraph) GetStatementRows(query string) []Properties {
+	return s.statements[query]
+}
+
 // NodeCount returns the number of nodes in the subgraph.
 func (s *StructuredSubgraph) NodeCount() int {
 	count := 0
@@ -310,6 +482,12 @@ func (s *StructuredSubgraph) RelKeys() []string {
 	return keys
 }
 
+// StatementQueries returns the list of statement queries in the subgraph, in
+// the order they were first added.
+func (s *StructuredSubgraph) StatementQueries() []string {
+	return s.queries
+}
+
 // createNodeSortKey returns the serialized node labels for sorting.
 func createNodeSortKey(matchLabel string, labels []string) string {
 	sort.Strings(labels)
@@ -324,25 +502,29 @@ func createRelSortKey(
 	return strings.Join([]string{rtype, startLabel, endLabel}, ",")
 }
 
-// DeserializeNodeKey returns the list of node labels from the serialized sort
-// key.
-func DeserializeNodeKey(sortKey string) (string, []string) {
+// DeserializeNodeKey returns the match label and list of node labels from the
+// serialized sort key. Returns an error wrapping ErrInvalidSortKey if the
+// sort key is invalid.
+func DeserializeNodeKey(sortKey string) (string, []string, error) {
 	parts := strings.Split(sortKey, ":")
 	if len(parts) != 2 {
-		panic(fmt.Sprintf("invalid node sort key: %s", sortKey))
+		return "", nil, fmt.Errorf(
+			"%w: node sort key %q", ErrInvalidSortKey, sortKey)
 	}
 	matchLabel, serializedLabels := parts[0], parts[1]
 	labels := strings.Split(serializedLabels, ",")
-	return matchLabel, labels
+	return matchLabel, labels, nil
 }
 
 // DeserializeRelKey returns the relationship type, start node label, and end
-// node label from the serialized sort key. Panics if the sort key is invalid.
-func DeserializeRelKey(sortKey string) (string, string, string) {
+// node label from the serialized sort key. Returns an error wrapping
+// ErrInvalidSortKey if the sort key is invalid.
+func DeserializeRelKey(sortKey string) (string, string, string, error) {
 	parts := strings.Split(sortKey, ",")
 	if len(parts) != 3 {
-		panic(fmt.Sprintf("invalid relationship sort key: %s", sortKey))
+		return "", "", "", fmt.Errorf(
+			"%w: relationship sort key %q", ErrInvalidSortKey, sortKey)
 	}
 	rtype, startLabel, endLabel := parts[0], parts[1], parts[2]
-	return rtype, startLabel, endLabel
+	return rtype, startLabel, endLabel, nil
 }
@@ -0,0 +1,63 @@
+// This module provides the mapping for hashtags from "t" tags and content.
+
+package lib
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ========================================
+// Hashtags
+// ========================================
+
+// contentHashtagPattern matches hashtags in event content that are not part
+// of a word, URL, or HTML entity.
+var contentHashtagPattern = regexp.MustCompile(
+	`(?:^|[^\p{L}\p{N}_&/#])#([\p{L}\p{N}_]+)`)
+
+// numericPattern matches strings of digits.
+var numericPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// MapHashtag links the event to the Hashtag node for the given tag with a
+// HAS_HASHTAG relationship. Hashtags are matched case-insensitively, and the
+// relationship keeps the original casing and where the hashtag was found.
+func (m *EventMapping) MapHashtag(hashtag string, source string) {
+	hashtag = strings.TrimPrefix(strings.TrimSpace(hashtag), "#")
+	if hashtag == "" || len(hashtag) > maxTagSize {
+		return
+	}
+
+	hashtagNode := NewHashtagNode(strings.ToLower(hashtag))
+	hashtagRel := NewHasHashtagRel(
+		m.EventNode,
+		hashtagNode,
+		Properties{"tag": hashtag, "source": source})
+
+	m.Subgraph.AddNode(hashtagNode)
+	m.Subgraph.AddRel(hashtagRel)
+}
+
+// MapContentHashtags links the event to each hashtag in its content that has
+// no matching "t" tag. Purely numeric hashtags are ignored.
+func (m *EventMapping) MapContentHashtags() {
+	tagged := NewSet[string]()
+	for _, tag := range m.Event.Tags {
+		if len(tag) >= 2 && tag[0] == "t" {
+			tagged.Add(strings.ToLower(
+				strings.TrimPrefix(strings.TrimSpace(tag[1]), "#")))
+		}
+	}
+
+	matches := contentHashtagPattern.FindAllStringSubmatch(m.Event.Content, -1)
+	for _, match := range matches {
+		hashtag := match[1]
+		if numericPattern.MatchString(hashtag) ||
+			tagged.Contains(strings.ToLower(hashtag)) {
+			continue
+		}
+		tagged.Add(strings.ToLower(hashtag))
+
+		m.MapHashtag(hashtag, "content")
+	}
+}
@@ -1,256 +1,533 @@
 package lib
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
-	"os"
-	"regexp"
-	"strings"
 	"sync"
 
 	"github.com/nbd-wtf/go-nostr"
-	"github.com/nbd-wtf/go-nostr/nip60"
-	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 )
 
 // Workers
 
-func ImportEvents() {
-	data, err := os.ReadFile("./zaps.json")
+// ImportOptions configures an event import.
+type ImportOptions struct {
+	// The input files, glob patterns, directories, or "-" for stdin.
+	Inputs []string
+	// The maximum size in bytes of a single input line.
+	MaxLineSize int
+	// The maximum number of lines to read across all inputs. Zero means no
+	// limit.
+	MaxLines int
+	// The path of the dead-letter JSONL file for rejected events and tags.
+	// Rejects are discarded if empty.
+	QuarantinePath string
+	// The path of the file that records a checkpoint after each merged batch.
+	// Checkpoints are discarded if empty.
+	CheckpointPath string
+	// Resume from the saved checkpoint instead of reading the inputs from
+	// the start.
+	Resume bool
+	// Maps events to subgraphs. The default mapper registry is used if nil.
+	Mappers EventMapper
+	// Configures the default mapper registry.
+	Mapping MapperOptions
+	// Configures the connection to the Neo4j database.
+	Neo4j Neo4jConfig
+}
+
+// MappedEvent is the subgraph mapped from a sourced event.
+type MappedEvent struct {
+	// The nodes and relationships mapped from the event.
+	Subgraph Subgraph
+	// The event the subgraph was mapped from.
+	Origin SourcedEvent
+}
+
+// StageError is a fatal error in a stage of the import pipeline. A stage that
+// fails stops processing but keeps draining its input, so that batches
+// already completed by the other stages are still merged.
+type StageError struct {
+	// The name of the stage that failed.
+	Stage string
+	// The underlying error.
+	Err error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// ErrInterrupted is returned by ImportEvents when its context is cancelled
+// before the inputs are exhausted. The events read before the interruption
+// are merged and checkpointed, so the import can be resumed.
+var ErrInterrupted = errors.New("import interrupted")
+
+// ImportEvents reads events from the inputs and merges them into the
+// database. If any stage of the pipeline fails or the context is cancelled,
+// reading stops, the events already read are merged, and the stage errors or
+// ErrInterrupted are returned. When resuming, reading starts just past the
+// saved checkpoint, so that only the events read after the last merged batch
+// are replayed.
+func ImportEvents(parent context.Context, opts ImportOptions) (err error) {
+	// The importer's own output is never read back as input.
+	sources, err := ResolveSources(opts.Inputs,
+		[]string{opts.QuarantinePath, opts.CheckpointPath})
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	events := make(chan nostr.Event)
+	checkpoints := NewCheckpointFile(opts.CheckpointPath)
+	resume := Checkpoint{}
+	if opts.Resume {
+		resume, err = checkpoints.Load()
+		if err != nil {
+			return err
+		}
+
+		sources, err = ResumeSources(sources, resume)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Resuming from %s line %d after event %s\n",
+			resume.Source, resume.Line, resume.EventID)
+	}
+
+	quarantine, err := NewQuarantine(opts.QuarantinePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, quarantine.Close())
+	}()
+
+	mappers := opts.Mappers
+	if mappers == nil {
+		mappers = NewDefaultMapperRegistry(opts.Mapping)
+	}
+
+	db, err := connectNeo4j(context.Background(), opts.Neo4j)
+	if err != nil {
+		return err
+	}
+	defer db.Close(context.Background())
+
+	// Reading stops when any stage reports an error or the import is
+	// interrupted.
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	errs := make(chan error)
+	failures := []error{}
+	monitorDone := make(chan struct{})
+
+	go func() {
+		defer close(monitorDone)
+		for err := range errs {
+			log.Printf("Import failed: %s\n", err)
+			failures = append(failures, err)
+			cancel()
+		}
+	}()
+
+	events := make(chan SourcedEvent)
 
 	var wg sync.WaitGroup
 	wg.Add(1)
 
 	go func() {
 		defer wg.Done()
-		ParseEvents(events)
+		ValidateEvents(events, mappers, db, quarantine, checkpoints, errs)
 	}()
 
-	var event nostr.Event
-
-	for i, line := range strings.Split(string(data), "\n") {
-		if i > 2000000 {
+	linesRead := 0
+	for i, source := range sources {
+		if ctx.Err() != nil {
 			break
 		}
 
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+		lineLimit := 0
+		if opts.MaxLines > 0 {
+			lineLimit = opts.MaxLines - linesRead
+			if lineLimit <= 0 {
+				break
+			}
 		}
 
-		event = nostr.Event{}
-		err = json.Unmarshal([]byte(line), &event)
-		if err != nil {
-			log.Println("Invalid event:", event)
+		// Only the first source is resumed part way through
+		from := Checkpoint{}
+		if i == 0 {
+			from = resume
 		}
 
-		events <- event
+		n, err := readSource(
+			ctx, source, opts.MaxLineSize, lineLimit, from, events, quarantine)
+		linesRead += n
+		if err != nil {
+			errs <- &StageError{Stage: "read", Err: err}
+			break
+		}
 	}
 
+	// Reading was interrupted if the parent was cancelled before the inputs
+	// were exhausted.
+	interrupted := parent.Err() != nil
+
+	// The stages drain the events already read and merge the final batch.
 	close(events)
 	wg.Wait()
+
+	close(errs)
+	<-monitorDone
+
+	if len(failures) == 0 && interrupted {
+		return ErrInterrupted
+	}
+
+	return errors.Join(failures...)
 }
 
-func ParseEvents(events chan nostr.Event) {
-	subgraphChannel := make(chan Subgraph)
+// readSource opens and decompresses a source and reads its events. Returns
+// the number of lines read.
+func readSource(
+	ctx context.Context,
+	source Source,
+	maxLineSize int,
+	lineLimit int,
+	from Checkpoint,
+	events chan SourcedEvent,
+	quarantine *Quarantine,
+) (int, error) {
+	input, err := source.Open()
+	if err != nil {
+		return 0, err
+	}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
+	// Closing the input interrupts a read blocked waiting for input, such as
+	// from an idle pipe, when reading is cancelled.
+	stop := context.AfterFunc(ctx, func() { input.Close() })
+	defer stop()
 
-	go func() {
-		defer wg.Done()
-		MergeEntities(subgraphChannel)
-	}()
+	reader, err := Decompress(source.Name, input)
+	if err != nil {
+		input.Close()
+		if ctx.Err() != nil {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer reader.Close()
 
-	for event := range events {
-		// fmt.Println(event.ID)
-		subgraph := *NewSubgraph()
+	return ReadEvents(
+		ctx, source.Name, reader, maxLineSize, lineLimit, from, events,
+		quarantine)
+}
 
-		// Create User and Event nodes
-		userNode := NewUserNode(event.PubKey)
-		eventNode := NewEventNode(event.ID)
+// ReadEvents streams events from the named source line by line and sends
+// them to the events channel, stopping after lineLimit lines if it is
+// positive or when the context is cancelled. The reader may be closed to
+// interrupt a blocked read when the context is cancelled, and the resulting
+// read error is treated as the end of the input. Reading starts just past the
+// given checkpoint, or at the start of the source if it is zero. Lines that
+// cannot be read or parsed are quarantined with their line number and
+// skipped. Returns the number of lines read.
+func ReadEvents(
+	ctx context.Context,
+	name string,
+	reader io.Reader,
+	maxLineSize int,
+	lineLimit int,
+	from Checkpoint,
+	events chan SourcedEvent,
+	quarantine *Quarantine,
+) (int, error) {
+	lines := NewLineReader(reader, maxLineSize)
+
+	if err := ResumeLines(lines, from); err != nil {
+		return 0, fmt.Errorf("resuming %s: %w", name, err)
+	}
 
-		eventNode.Props["created_at"] = event.CreatedAt.Time().Unix()
-		eventNode.Props["kind"] = event.Kind
-		eventNode.Props["content"] = event.Content
+	// Lines skipped when resuming do not count toward the limit
+	for lineLimit <= 0 || lines.LineNumber()-from.Line < lineLimit {
+		line, err := lines.Next()
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, ErrLineTooLong) {
+			log.Printf("Skipping %s: %s\n", name, err)
+			err = quarantine.RejectLine(
+				name, lines.LineNumber(), nil, ReasonLineTooLong, err)
+			if err != nil {
+				return lines.LineNumber() - from.Line, err
+			}
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				// The input was closed to interrupt reading
+				return lines.LineNumber() - from.Line, nil
+			}
+			return lines.LineNumber() - from.Line,
+				fmt.Errorf("reading %s: %w", name, err)
+		}
 
-		if event.Kind == nostr.KindZap {
-			// Event is a zap receipt
-			// Write the zap amount to the event
-			eventNode.Labels.Add("ZapReceiptEvent")
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
 		}
 
-		authorRel := NewSignedRel(userNode, eventNode, nil)
+		event := nostr.Event{}
+		err = json.Unmarshal(line, &event)
+		if err != nil {
+			log.Printf("Invalid event on %s line %d: %s\n",
+				name, lines.LineNumber(), err)
+			err = quarantine.RejectLine(
+				name, lines.LineNumber(), line, ReasonInvalidJSON, err)
+			if err != nil {
+				return lines.LineNumber() - from.Line, err
+			}
+			continue
+		}
 
-		subgraph.AddNode(userNode)
-		subgraph.AddNode(eventNode)
-		subgraph.AddRel(authorRel)
+		select {
+		case events <- SourcedEvent{
+			Event:      event,
+			Source:     name,
+			Line:       lines.LineNumber(),
+			LineOffset: lines.LineOffset(),
+			Offset:     lines.Offset(),
+		}:
+		case <-ctx.Done():
+			return lines.LineNumber() - from.Line, nil
+		}
+	}
 
-		// Create Tag nodes
-		for _, tag := range event.Tags {
-			if len(tag) >= 2 {
-				name := tag[0]
-				value := tag[1]
-				var rest []string
+	return lines.LineNumber() - from.Line, nil
+}
 
-				if len(name)+len(value) > 8192 {
-					// Skip tags that are too large for the neo4j indexer
-					continue
-				}
+// ParseEvents maps each event to a subgraph with the mapper registered for
+// its kind and sends it to MergeEntities. Tags rejected by the mapper are
+// quarantined. Events the mapper returns no subgraph for are skipped.
+func ParseEvents(
+	events chan SourcedEvent,
+	mappers EventMapper,
+	db *Database,
+	quarantine *Quarantine,
+	checkpoints *CheckpointFile,
+	errs chan<- error,
+) {
+	subgraphChannel := make(chan MappedEvent)
 
-				if len(tag) > 2 {
-					rest = append([]string{}, tag[2:]...)
-				}
+	var wg sync.WaitGroup
+	wg.Add(1)
 
-				if event.Kind == nostr.KindZap && name == "bolt11" {
-					amount, err := nip60.GetSatoshisAmountFromBolt11(value)
-					if err == nil {
-						eventNode.Props["amount"] = amount
-					} else {
-						fmt.Println("Invalid bolt11 amount:", err)
-					}
-				}
+	go func() {
+		defer wg.Done()
+		MergeEntities(subgraphChannel, db, quarantine, checkpoints, errs)
+	}()
 
-				if name == "e" &&
-					len(value) == 64 &&
-					regexp.MustCompile(`^[0-9a-f]{64}$`).MatchString(value) {
-					// Tag is an event reference
-					// Create a relationship to the referenced event
-					referencedEventNode := NewEventNode(value)
-					referencesRel := NewReferencesEventRel(
-						eventNode,
-						referencedEventNode,
-						map[string]any{
-							"name":  name,
-							"value": value,
-							"rest":  rest,
-						})
-					subgraph.AddNode(referencedEventNode)
-					subgraph.AddRel(referencesRel)
-
-				} else if name == "p" &&
-					len(value) == 64 &&
-					regexp.MustCompile(`^[0-9a-f]{64}$`).MatchString(value) {
-					// Tag is a user reference
-					// Create a relationship to the referenced user
-					referencedUserNode := NewUserNode(value)
-					referencesRel := NewReferencesUserRel(
-						eventNode,
-						referencedUserNode,
-						map[string]any{
-							"name":  name,
-							"value": value,
-							"rest":  rest,
-						})
-					subgraph.AddNode(referencedUserNode)
-					subgraph.AddRel(referencesRel)
-
-				} else {
-					// Generic Tag
-					tagNode := NewTagNode(name, value, rest)
-					tagRel := NewTaggedRel(eventNode, tagNode, nil)
-					subgraph.AddNode(tagNode)
-					subgraph.AddRel(tagRel)
-				}
+	failed := false
+	for sourced := range events {
+		if failed {
+			// Drain the input after a failure
+			continue
+		}
+
+		subgraph, rejections := mappers.Map(sourced.Event)
+
+		for _, rejection := range rejections {
+			err := quarantine.RejectTag(
+				sourced, rejection.Tag, rejection.Reason, rejection.Err)
+			if err != nil {
+				errs <- &StageError{Stage: "parse", Err: err}
+				failed = true
+				break
 			}
 		}
+		if failed || subgraph == nil {
+			continue
+		}
 
-		subgraphChannel <- subgraph
+		subgraphChannel <- MappedEvent{
+			Subgraph: *subgraph,
+			Origin:   sourced,
+		}
 	}
 
 	close(subgraphChannel)
 	wg.Wait()
 }
 
-func MergeEntities(subgraphChannel chan Subgraph) {
+// MergeEntities collects mapped events into batches and merges each batch
+// into the database, saving a checkpoint after each one. Events whose
+// subgraph is invalid are quarantined. The final partial batch is merged when
+// the input is exhausted.
+func MergeEntities(
+	subgraphChannel chan MappedEvent,
+	db *Database,
+	quarantine *Quarantine,
+	checkpoints *CheckpointFile,
+	errs chan<- error,
+) {
 	ctx := context.Background()
-	driver, err := connectNeo4j(ctx)
-	if err != nil {
-		panic(err)
-	}
-	defer driver.Close(ctx)
 
 	batchSize := 25000
-	matchProvider := NewMatchKeys()
-	subgraph := NewStructuredSubgraph(matchProvider)
+	subgraph := newBatchSubgraph()
+	batch := []MappedEvent{}
 
-	for sg := range subgraphChannel {
-		for _, node := range sg.nodes {
-			subgraph.AddNode(node)
+	failed := false
+	for mapped := range subgraphChannel {
+		if failed {
+			// Drain the input after a failure
+			continue
 		}
-		for _, rel := range sg.rels {
-			subgraph.AddRel(rel)
+
+		if err := subgraph.AddSubgraph(&mapped.Subgraph); err != nil {
+			log.Printf("Invalid subgraph for %s line %d: %s\n",
+				mapped.Origin.Source, mapped.Origin.Line, err)
+			err = quarantine.RejectEvent(
+				mapped.Origin, ReasonInvalidSubgraph, err)
+			if err != nil {
+				errs <- &StageError{Stage: "merge", Err: err}
+				failed = true
+			}
+			continue
 		}
+		batch = append(batch, mapped)
 
 		if subgraph.NodeCount() > batchSize {
-			mergeSubgraph(ctx, driver, subgraph)
-			subgraph = NewStructuredSubgraph(matchProvider)
+			err := mergeBatch(ctx, db, subgraph, batch, quarantine)
+			if err == nil {
+				err = saveCheckpoint(checkpoints, batch, quarantine)
+			}
+			if err != nil {
+				errs <- &StageError{Stage: "merge", Err: err}
+				failed = true
+			}
+			subgraph = newBatchSubgraph()
+			batch = []MappedEvent{}
 		}
 	}
 
-	mergeSubgraph(ctx, driver, subgraph)
+	if failed {
+		return
+	}
+
+	err := mergeBatch(ctx, db, subgraph, batch, quarantine)
+	if err == nil {
+		err = saveCheckpoint(checkpoints, batch, quarantine)
+	}
+	if err != nil {
+		errs <- &StageError{Stage: "merge", Err: err}
+	}
 }
 
 // Helper Functions
 
-func connectNeo4j(ctx context.Context) (neo4j.DriverWithContext, error) {
-	dbUri := "neo4j://localhost:7687"
-	dbUser := "neo4j"
-	dbPassword := "neo4jnostr"
-	driver, err := neo4j.NewDriverWithContext(
-		dbUri,
-		neo4j.BasicAuth(dbUser, dbPassword, ""))
+// newBatchSubgraph creates an empty subgraph to collect a batch into.
+func newBatchSubgraph() *StructuredSubgraph {
+	return NewStructuredSubgraph(NewMatchKeys(), NewRelMatchKeys())
+}
 
-	err = driver.VerifyConnectivity(ctx)
-	if err != nil {
-		return driver, err
+// saveCheckpoint saves a checkpoint just past the last event of a merged
+// batch. The quarantine is flushed first, so that the events rejected before
+// the checkpoint are not lost if the import is interrupted.
+func saveCheckpoint(
+	checkpoints *CheckpointFile,
+	batch []MappedEvent,
+	quarantine *Quarantine,
+) error {
+	if len(batch) == 0 {
+		return nil
 	}
 
-	indexQueries := []string{
-		`CREATE CONSTRAINT user_pubkey IF NOT EXISTS
-		 FOR (n:User) REQUIRE n.pubkey IS UNIQUE`,
+	if err := quarantine.Flush(); err != nil {
+		return err
+	}
+
+	return checkpoints.Save(NewCheckpoint(batch[len(batch)-1].Origin))
+}
+
+// mergeBatch merges the subgraph of a batch of mapped events into the
+// database. If the merge fails with an error that may have been caused by the
+// data, the batch is split in half and each half is merged on its own, until
+// the events that cannot be merged are isolated and quarantined. A batch that
+// runs out of memory is split the same way, but is never quarantined. Merges
+// are idempotent, so the parts of a failed merge that were written are merged
+// again harmlessly. Returns an error, without quarantining the batch, for any
+// other failure, such as an unavailable database or expired credentials, or
+// if the events cannot be quarantined.
+func mergeBatch(
+	ctx context.Context,
+	db *Database,
+	subgraph *StructuredSubgraph,
+	batch []MappedEvent,
+	quarantine *Quarantine,
+) error {
+	err := mergeSubgraph(ctx, db, subgraph)
+	if err == nil {
+		return nil
+	}
+
+	// Errors that are not caused by the batch's contents stop the import
+	// without checkpointing the batch, so that it is merged again on resume.
+	outOfMemory := IsOutOfMemory(err)
+	if !outOfMemory && !IsDataError(err) {
+		return fmt.Errorf("merging batch of %d events: %w", len(batch), err)
+	}
 
-		`CREATE INDEX user_pubkey IF NOT EXISTS
-		 FOR (n:User) ON (n.pubkey)`,
+	if len(batch) > 1 {
+		log.Printf("Failed to merge batch of %d events, splitting: %s\n",
+			len(batch), err)
 
-		`CREATE INDEX event_id IF NOT EXISTS
-		 FOR (n:Event) ON (n.id)`,
+		middle := len(batch) / 2
+		for _, half := range [][]MappedEvent{batch[:middle], batch[middle:]} {
+			subgraph := newBatchSubgraph()
+			for _, mapped := range half {
+				if err := subgraph.AddSubgraph(&mapped.Subgraph); err != nil {
+					return err
+				}
+			}
 
-		`CREATE INDEX event_kind IF NOT EXISTS
-		 FOR (n:Event) ON (n.kind)`,
+			if err := mergeBatch(ctx, db, subgraph, half, quarantine); err != nil {
+				return err
+			}
+		}
 
-		`CREATE INDEX tag_name_value IF NOT EXISTS
-		 FOR (n:Tag) ON (n.name, n.value)`,
+		return nil
 	}
 
-	// Create indexes/constraints
-	for _, query := range indexQueries {
-		_, err = neo4j.ExecuteQuery(ctx, driver,
-			query,
-			nil,
-			neo4j.EagerResultTransformer,
-			neo4j.ExecuteQueryWithDatabase("neo4j"))
+	if outOfMemory {
+		return fmt.Errorf("merging event: %w", err)
+	}
 
-		if err != nil {
-			panic(err)
+	log.Printf("Failed to merge batch of %d events: %s\n", len(batch), err)
+	for _, mapped := range batch {
+		rejectErr := quarantine.RejectEvent(
+			mapped.Origin, ReasonMergeFailed, err)
+		if rejectErr != nil {
+			return rejectErr
 		}
 	}
 
-	return driver, nil
+	return nil
 }
 
 func mergeSubgraph(
 	ctx context.Context,
-	driver neo4j.DriverWithContext,
+	db *Database,
 	subgraph *StructuredSubgraph,
-) {
+) error {
 
 	// fmt.Println("Got node keys:", subgraph.NodeKeys())
 	// fmt.Println("Got rel keys:", subgraph.RelKeys())
@@ -258,42 +535,68 @@ func mergeSubgraph(
 	// fmt.Println("Rel count:", subgraph.RelCount())
 
 	for _, nodeKey := range subgraph.NodeKeys() {
-		matchLabel, labels := DeserializeNodeKey(nodeKey)
-		mergeNodes(
-			ctx, driver,
+		matchLabel, labels, err := DeserializeNodeKey(nodeKey)
+		if err != nil {
+			return err
+		}
+		err = mergeNodes(
+			ctx, db,
 			matchLabel,
 			labels,
 			subgraph.matchProvider,
 			subgraph.GetNodes(nodeKey),
 		)
+		if err != nil {
+			return err
+		}
 	}
 
 	for _, relKey := range subgraph.RelKeys() {
-		rtype, startLabel, endLabel := DeserializeRelKey(relKey)
-		mergeRels(
-			ctx, driver,
+		rtype, startLabel, endLabel, err := DeserializeRelKey(relKey)
+		if err != nil {
+			return err
+		}
+		err = mergeRels(
+			ctx, db,
 			rtype,
 			startLabel,
 			endLabel,
 			subgraph.matchProvider,
+			subgraph.relMatchProvider,
 			subgraph.GetRels(relKey),
 		)
+		if err != nil {
+			return err
+		}
 	}
+
+	for _, query := range subgraph.StatementQueries() {
+		err := runStatements(
+			ctx, db,
+			query,
+			subgraph.GetStatementRows(query),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func mergeNodes(
 	ctx context.Context,
-	driver neo4j.DriverWithContext,
+	db *Database,
 	matchLabel string,
 	nodeLabels []string,
 	matchProvider MatchKeysProvider,
 	nodes []*Node,
-) {
+) error {
 	cypherLabels := ToCypherLabels(nodeLabels)
 
 	matchKeys, exists := matchProvider.GetKeys(matchLabel)
 	if !exists {
-		panic(fmt.Errorf("unknown match label: %s", matchLabel))
+		return fmt.Errorf("unknown match label: %s", matchLabel)
 	}
 
 	cypherProps := ToCypherProps(matchKeys, "node.")
@@ -315,49 +618,58 @@ func mergeNodes(
 	// fmt.Println("First node:", *serializedNodes[0])
 	// fmt.Printf("Generated query:\n```\n%s\n```\n", query)
 
-	result, err := neo4j.ExecuteQuery(ctx, driver,
+	summary, err := db.ExecuteWrite(ctx,
 		query,
 		map[string]any{
 			"nodes": serializedNodes,
-		}, neo4j.EagerResultTransformer,
-		neo4j.ExecuteQueryWithDatabase("neo4j"))
+		})
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	summary := result.Summary
 	fmt.Printf("Created %v nodes in %+v.\n",
 		summary.Counters().NodesCreated(),
 		summary.ResultAvailableAfter())
+
+	return nil
 }
 
 func mergeRels(
 	ctx context.Context,
-	driver neo4j.DriverWithContext,
+	db *Database,
 	rtype string,
 	startLabel string,
 	endLabel string,
 	matchProvider MatchKeysProvider,
+	relMatchProvider MatchKeysProvider,
 	rels []*Relationship,
-) {
+) error {
 	cypherType := ToCypherLabel(rtype)
 	startCypherLabel := ToCypherLabel(startLabel)
 	endCypherLabel := ToCypherLabel(endLabel)
 
 	matchKeys, exists := matchProvider.GetKeys(startLabel)
 	if !exists {
-		panic(fmt.Errorf("unknown start node label: %s", startLabel))
+		return fmt.Errorf("unknown start node label: %s", startLabel)
 	}
 
 	startCypherProps := ToCypherProps(matchKeys, "rel.start.")
 
 	matchKeys, exists = matchProvider.GetKeys(endLabel)
 	if !exists {
-		panic(fmt.Errorf("unknown end node label: %s", endLabel))
+		return fmt.Errorf("unknown end node label: %s", endLabel)
 	}
 
 	endCypherProps := ToCypherProps(matchKeys, "rel.end.")
 
+	// Relationships with match keys are merged by their match properties as
+	// well as their start and end nodes.
+	relCypherProps := ""
+	if matchKeys, exists := relMatchProvider.GetKeys(rtype); exists {
+		relCypherProps = fmt.Sprintf(
+			" { %s }", ToCypherProps(matchKeys, "rel.props."))
+	}
+
 	serializedRels := []*SerializedRel{}
 	for _, rel := range rels {
 		serializedRels = append(serializedRels, rel.Serialize())
@@ -369,29 +681,51 @@ func mergeRels(
 		MATCH (start%s { %s })
 		MATCH (end%s { %s })
 
-		MERGE (start)-[r%s]->(end)
+		MERGE (start)-[r%s%s]->(end)
 		SET r += rel.props
 		`,
 		startCypherLabel, startCypherProps,
 		endCypherLabel, endCypherProps,
-		cypherType,
+		cypherType, relCypherProps,
 	)
 
 	// fmt.Println("First rel:", *serializedRels[0])
 	// fmt.Printf("Generated query:\n```\n%s\n```\n", query)
 
-	result, err := neo4j.ExecuteQuery(ctx, driver,
+	summary, err := db.ExecuteWrite(ctx,
 		query,
 		map[string]any{
 			"rels": serializedRels,
-		}, neo4j.EagerResultTransformer,
-		neo4j.ExecuteQueryWithDatabase("neo4j"))
+		})
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	summary := result.Summary
 	fmt.Printf("Created %v relationships in %+v.\n",
 		summary.Counters().RelationshipsCreated(),
 		summary.ResultAvailableAfter())
+
+	return nil
+}
+
+func runStatements(
+	ctx context.Context,
+	db *Database,
+	query string,
+	rows []Properties,
+) error {
+	summary, err := db.ExecuteWrite(ctx,
+		query,
+		map[string]any{
+			"rows": rows,
+		})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Ran statement on %v rows in %+v.\n",
+		len(rows),
+		summary.ResultAvailableAfter())
+
+	return nil
 }
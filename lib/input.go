@@ -0,0 +1,416 @@
+// This module provides methods for resolving input sources, decompressing
+// them, and streaming newline-delimited event records from them.
+
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ========================================
+// Constants
+// ========================================
+
+// DefaultMaxLineSize is the default maximum size in bytes of a single input
+// line.
+const DefaultMaxLineSize = 1024 * 1024
+
+// readBufferSize is the size of the buffer used to read from the input.
+const readBufferSize = 64 * 1024
+
+// ErrLineTooLong is returned when an input line exceeds the maximum line size.
+var ErrLineTooLong = errors.New("line exceeds maximum line size")
+
+// ========================================
+// Line Reader
+// ========================================
+
+// LineReader reads newline-delimited records from an input one line at a
+// time, holding at most one line in memory.
+type LineReader struct {
+	// The buffered input.
+	reader *bufio.Reader
+	// The maximum size in bytes of a single line.
+	maxLineSize int
+	// The number of the last line read, starting at 1.
+	lineNumber int
+	// The number of bytes consumed from the input.
+	offset int64
+	// The byte offset of the start of the last line read.
+	lineOffset int64
+	// The buffer holding the current line.
+	line []byte
+}
+
+// NewLineReader creates a line reader over the given input. Lines longer than
+// maxLineSize are discarded. If maxLineSize is not positive, the default
+// maximum line size is used.
+func NewLineReader(reader io.Reader, maxLineSize int) *LineReader {
+	if maxLineSize <= 0 {
+		maxLineSize = DefaultMaxLineSize
+	}
+	return &LineReader{
+		reader:      bufio.NewReaderSize(reader, readBufferSize),
+		maxLineSize: maxLineSize,
+	}
+}
+
+// LineNumber returns the number of the last line read.
+func (r *LineReader) LineNumber() int {
+	return r.lineNumber
+}
+
+// Offset returns the number of bytes consumed from the input, which is the
+// offset just past the last line read.
+func (r *LineReader) Offset() int64 {
+	return r.offset
+}
+
+// LineOffset returns the byte offset of the start of the last line read.
+func (r *LineReader) LineOffset() int64 {
+	return r.lineOffset
+}
+
+// Skip discards the input up to the given byte offset, which must be the end
+// of the given line, so that reading continues from the following line.
+// Used to resume reading from a checkpoint.
+func (r *LineReader) Skip(offset int64, lineNumber int) error {
+	n, err := io.CopyN(io.Discard, r.reader, offset-r.offset)
+	r.offset += n
+	if err == io.EOF {
+		return fmt.Errorf(
+			"input ends at byte %d before offset %d", r.offset, offset)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.lineNumber = lineNumber
+	r.lineOffset = offset
+	return nil
+}
+
+// Next returns the next line without its line ending. The returned slice is
+// only valid until the following call to Next. Returns ErrLineTooLong if the
+// line exceeds the maximum line size, and io.EOF when the input is exhausted.
+func (r *LineReader) Next() ([]byte, error) {
+	r.line = r.line[:0]
+	r.lineOffset = r.offset
+	read := false
+	tooLong := false
+
+	for {
+		chunk, err := r.reader.ReadSlice('\n')
+		if len(chunk) > 0 {
+			read = true
+			r.offset += int64(len(chunk))
+		}
+
+		// Keep the chunk unless the line has already overflowed, in which
+		// case the rest of the line is discarded.
+		if !tooLong {
+			r.line = append(r.line, chunk...)
+			if len(trimLineEnding(r.line)) > r.maxLineSize {
+				tooLong = true
+				r.line = r.line[:0]
+			}
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		if err == io.EOF && !read {
+			return nil, io.EOF
+		}
+
+		r.lineNumber++
+		if tooLong {
+			return nil, fmt.Errorf("line %d: %w", r.lineNumber, ErrLineTooLong)
+		}
+		return trimLineEnding(r.line), nil
+	}
+}
+
+// trimLineEnding removes a trailing "\n" or "\r\n" from the line.
+func trimLineEnding(line []byte) []byte {
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return line
+}
+
+// ========================================
+// Input Sources
+// ========================================
+
+// StdinInput is the input argument that selects standard input.
+const StdinInput = "-"
+
+// Source is a named input stream of event records.
+type Source struct {
+	// The name of the source, used to report errors.
+	Name string
+	// Opens the source for reading.
+	Open func() (io.ReadCloser, error)
+}
+
+// NewFileSource creates a source that reads from the file at the given path.
+func NewFileSource(path string) Source {
+	return Source{
+		Name: path,
+		Open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+	}
+}
+
+// NewStdinSource creates a source that reads from standard input. Where the
+// platform allows, closing the opened reader interrupts a blocked read.
+func NewStdinSource() Source {
+	return Source{
+		Name: "stdin",
+		Open: openStdin,
+	}
+}
+
+// ResolveSources expands the given input arguments into an ordered list of
+// sources. Each input may be a file path, a glob pattern, a directory, or "-"
+// for standard input. Glob matches and directory contents are expanded in
+// lexical order so that imports are deterministic. Hidden files and
+// directories, and the excluded paths, such as the importer's own quarantine
+// and checkpoint files, are left out of the expansion.
+func ResolveSources(inputs []string, exclude []string) ([]Source, error) {
+	sources := []Source{}
+
+	excluded := map[string]bool{}
+	for _, path := range exclude {
+		if path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		excluded[abs] = true
+	}
+
+	for _, input := range inputs {
+		if input == StdinInput {
+			sources = append(sources, NewStdinSource())
+			continue
+		}
+
+		if !isGlobPattern(input) {
+			files, err := expandPath(input, excluded)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				sources = append(sources, NewFileSource(file))
+			}
+			continue
+		}
+
+		matches, err := filepath.Glob(input)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %s: %w", input, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", input)
+		}
+		sort.Strings(matches)
+
+		// Hidden matches are only taken if the pattern asks for them.
+		hidden := isHidden(filepath.Base(input))
+		for _, match := range matches {
+			if (isHidden(filepath.Base(match)) && !hidden) ||
+				isExcluded(match, excluded) {
+				continue
+			}
+			files, err := expandPath(match, excluded)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				sources = append(sources, NewFileSource(file))
+			}
+		}
+	}
+
+	return sources, nil
+}
+
+// isGlobPattern reports whether the input contains glob metacharacters.
+func isGlobPattern(input string) bool {
+	return strings.ContainsAny(input, "*?[")
+}
+
+// isHidden reports whether a file name is hidden by the dot convention.
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
+// isExcluded reports whether the path is one of the excluded absolute paths.
+func isExcluded(path string, excluded map[string]bool) bool {
+	abs, err := filepath.Abs(path)
+	return err == nil && excluded[abs]
+}
+
+// expandPath returns the path itself if it is a file, or the regular files
+// beneath it in lexical order if it is a directory. Hidden entries and
+// excluded files beneath a directory are skipped.
+func expandPath(path string, excluded map[string]bool) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	// WalkDir visits entries in lexical order.
+	files := []string{}
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != path && isHidden(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && !isExcluded(p, excluded) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// ========================================
+// Decompression
+// ========================================
+
+// compression identifies the compression format of an input.
+type compression string
+
+const (
+	compressionNone  compression = ""
+	compressionGzip  compression = "gzip"
+	compressionZstd  compression = "zstd"
+	compressionBzip2 compression = "bzip2"
+)
+
+// Magic bytes at the start of each compressed format.
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+)
+
+// Decompress wraps the named input in a streaming decompressor if it is
+// compressed with gzip, zstd, or bzip2. The format is detected from the magic
+// bytes at the start of the input, not the file extension. Uncompressed
+// inputs are returned as-is. Closing the returned reader closes
+// the input.
+func Decompress(name string, input io.ReadCloser) (io.ReadCloser, error) {
+	buffered := bufio.NewReaderSize(input, readBufferSize)
+
+	format, err := detectCompression(name, buffered)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case compressionGzip:
+		reader, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("opening gzip stream %s: %w", name, err)
+		}
+		return &decompressedReader{reader, []io.Closer{reader, input}}, nil
+
+	case compressionZstd:
+		decoder, err := zstd.NewReader(buffered, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("opening zstd stream %s: %w", name, err)
+		}
+		reader := decoder.IOReadCloser()
+		return &decompressedReader{reader, []io.Closer{reader, input}}, nil
+
+	case compressionBzip2:
+		reader := bzip2.NewReader(buffered)
+		return &decompressedReader{reader, []io.Closer{input}}, nil
+
+	default:
+		return &decompressedReader{buffered, []io.Closer{input}}, nil
+	}
+}
+
+// detectCompression determines the compression format of the named input
+// from its magic bytes.
+func detectCompression(
+	name string, reader *bufio.Reader) (compression, error) {
+
+	header, err := reader.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return compressionNone, fmt.Errorf("reading %s: %w", name, err)
+	}
+
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return compressionGzip, nil
+	case bytes.HasPrefix(header, zstdMagic):
+		return compressionZstd, nil
+	case bytes.HasPrefix(header, bzip2Magic):
+		return compressionBzip2, nil
+	}
+
+	// Compressed streams always start with their magic bytes, so an empty or
+	// mislabelled input is read as-is rather than failing to decompress.
+	return compressionNone, nil
+}
+
+// decompressedReader reads from a decompressed stream and closes the
+// decompressor and the underlying input together.
+type decompressedReader struct {
+	io.Reader
+	// The closers to call, innermost first.
+	closers []io.Closer
+}
+
+func (r *decompressedReader) Close() error {
+	var err error
+	for _, closer := range r.closers {
+		if cerr := closer.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
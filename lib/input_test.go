@@ -0,0 +1,296 @@
+package lib
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readLine is a line returned by LineReader.Next with the reader's position
+// after reading it.
+type readLine struct {
+	text       string
+	err        error
+	number     int
+	lineOffset int64
+	offset     int64
+}
+
+// readLines reads every line from the reader until io.EOF.
+func readLines(t *testing.T, lines *LineReader) []readLine {
+	t.Helper()
+
+	got := []readLine{}
+	for {
+		line, err := lines.Next()
+		if err == io.EOF {
+			return got
+		}
+		if err != nil && !errors.Is(err, ErrLineTooLong) {
+			t.Fatalf("Next() failed: %s", err)
+		}
+		got = append(got, readLine{
+			text:       string(line),
+			err:        errors.Unwrap(err),
+			number:     lines.LineNumber(),
+			lineOffset: lines.LineOffset(),
+			offset:     lines.Offset(),
+		})
+	}
+}
+
+func TestLineReaderNext(t *testing.T) {
+	long := strings.Repeat("x", readBufferSize+10)
+
+	tests := []struct {
+		name        string
+		input       string
+		maxLineSize int
+		want        []readLine
+	}{
+		{
+			name:  "empty input",
+			input: "",
+			want:  []readLine{},
+		},
+		{
+			name:  "newline terminated",
+			input: "a\nbc\n",
+			want: []readLine{
+				{text: "a", number: 1, lineOffset: 0, offset: 2},
+				{text: "bc", number: 2, lineOffset: 2, offset: 5},
+			},
+		},
+		{
+			name:  "final line without newline",
+			input: "a\nbc",
+			want: []readLine{
+				{text: "a", number: 1, lineOffset: 0, offset: 2},
+				{text: "bc", number: 2, lineOffset: 2, offset: 4},
+			},
+		},
+		{
+			name:  "crlf line endings",
+			input: "a\r\nbc\r\n",
+			want: []readLine{
+				{text: "a", number: 1, lineOffset: 0, offset: 3},
+				{text: "bc", number: 2, lineOffset: 3, offset: 7},
+			},
+		},
+		{
+			name:  "empty lines",
+			input: "\n\r\na\n",
+			want: []readLine{
+				{text: "", number: 1, lineOffset: 0, offset: 1},
+				{text: "", number: 2, lineOffset: 1, offset: 3},
+				{text: "a", number: 3, lineOffset: 3, offset: 5},
+			},
+		},
+		{
+			name:        "too long line is skipped",
+			input:       "abcdef\nabc\n",
+			maxLineSize: 3,
+			want: []readLine{
+				{err: ErrLineTooLong, number: 1, lineOffset: 0, offset: 7},
+				{text: "abc", number: 2, lineOffset: 7, offset: 11},
+			},
+		},
+		{
+			name:        "line ending does not count towards size",
+			input:       "abc\r\n",
+			maxLineSize: 3,
+			want: []readLine{
+				{text: "abc", number: 1, lineOffset: 0, offset: 5},
+			},
+		},
+		{
+			name:  "line longer than read buffer",
+			input: long + "\na\n",
+			want: []readLine{
+				{text: long, number: 1, lineOffset: 0,
+					offset: int64(len(long) + 1)},
+				{text: "a", number: 2, lineOffset: int64(len(long) + 1),
+					offset: int64(len(long) + 3)},
+			},
+		},
+		{
+			name:        "too long line longer than read buffer",
+			input:       long + "\na\n",
+			maxLineSize: 10,
+			want: []readLine{
+				{err: ErrLineTooLong, number: 1, lineOffset: 0,
+					offset: int64(len(long) + 1)},
+				{text: "a", number: 2, lineOffset: int64(len(long) + 1),
+					offset: int64(len(long) + 3)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := NewLineReader(strings.NewReader(tt.input), tt.maxLineSize)
+			got := readLines(t, lines)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("read %d lines, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("line %d = %+v, want %+v", i+1, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLineReaderSkip(t *testing.T) {
+	input := "a\nbc\ndef\n"
+
+	tests := []struct {
+		name       string
+		offset     int64
+		lineNumber int
+		want       []readLine
+		wantErr    bool
+	}{
+		{
+			name:       "start of input",
+			offset:     0,
+			lineNumber: 0,
+			want: []readLine{
+				{text: "a", number: 1, lineOffset: 0, offset: 2},
+				{text: "bc", number: 2, lineOffset: 2, offset: 5},
+				{text: "def", number: 3, lineOffset: 5, offset: 9},
+			},
+		},
+		{
+			name:       "after first line",
+			offset:     2,
+			lineNumber: 1,
+			want: []readLine{
+				{text: "bc", number: 2, lineOffset: 2, offset: 5},
+				{text: "def", number: 3, lineOffset: 5, offset: 9},
+			},
+		},
+		{
+			name:       "end of input",
+			offset:     9,
+			lineNumber: 3,
+			want:       []readLine{},
+		},
+		{
+			name:       "past end of input",
+			offset:     10,
+			lineNumber: 4,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := NewLineReader(strings.NewReader(input), 0)
+			err := lines.Skip(tt.offset, tt.lineNumber)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Skip(%d) succeeded, want error", tt.offset)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Skip(%d) failed: %s", tt.offset, err)
+			}
+			if lines.LineNumber() != tt.lineNumber {
+				t.Errorf("LineNumber() = %d, want %d",
+					lines.LineNumber(), tt.lineNumber)
+			}
+
+			got := readLines(t, lines)
+			if len(got) != len(tt.want) {
+				t.Fatalf("read %d lines, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("line %d = %+v, want %+v", i+1, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestResolveSources(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{
+		"a.jsonl",
+		"b.jsonl.gz",
+		"nested/c.jsonl",
+		".hidden.jsonl",
+		".cache/d.jsonl",
+		".checkpoint-123",
+		"checkpoint.json",
+		"quarantine.jsonl",
+	} {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exclude := []string{
+		filepath.Join(dir, "quarantine.jsonl"),
+		filepath.Join(dir, "checkpoint.json"),
+	}
+
+	tests := []struct {
+		name   string
+		inputs []string
+		want   []string
+	}{
+		{
+			name:   "directory",
+			inputs: []string{dir},
+			want:   []string{"a.jsonl", "b.jsonl.gz", "nested/c.jsonl"},
+		},
+		{
+			name:   "glob",
+			inputs: []string{filepath.Join(dir, "*")},
+			want:   []string{"a.jsonl", "b.jsonl.gz", "nested/c.jsonl"},
+		},
+		{
+			name:   "hidden glob",
+			inputs: []string{filepath.Join(dir, ".*.jsonl")},
+			want:   []string{".hidden.jsonl"},
+		},
+		{
+			name:   "named files",
+			inputs: []string{filepath.Join(dir, ".hidden.jsonl"), "-"},
+			want:   []string{".hidden.jsonl", "stdin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources, err := ResolveSources(tt.inputs, exclude)
+			if err != nil {
+				t.Fatalf("ResolveSources() failed: %s", err)
+			}
+
+			got := []string{}
+			for _, source := range sources {
+				name, err := filepath.Rel(dir, source.Name)
+				if err != nil || source.Name == "stdin" {
+					name = source.Name
+				}
+				got = append(got, filepath.ToSlash(name))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResolveSources() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// This module provides the mapping for NIP-32 labels.
+
+package lib
+
+import (
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ========================================
+// Label Mapper
+// ========================================
+
+// ugcNamespace is the implied namespace of labels without one.
+const ugcNamespace = "ugc"
+
+// LabelMapper maps a kind 1985 label event to LABELS relationships from the
+// event to each labelled event, user, address, and relay. The labels
+// themselves are mapped by the default tag mapping, which links the event to
+// a Label node for each "l" tag.
+type LabelMapper struct{}
+
+func (LabelMapper) Map(event nostr.Event) (*Subgraph, []TagRejection) {
+	mapping := NewEventMapping(event)
+	mapping.MapTags(nil)
+
+	labelsProps := Properties{"created_at": event.CreatedAt.Time().Unix()}
+
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || len(tag[0])+len(tag[1]) > maxTagSize {
+			continue
+		}
+
+		var targetNode *Node
+		var labelsRel *Relationship
+
+		switch tag[0] {
+		case "e":
+			if !isHexID(tag[1]) {
+				continue
+			}
+			targetNode = NewEventNode(tag[1])
+			labelsRel = NewLabelsEventRel(
+				mapping.EventNode, targetNode, labelsProps)
+		case "p":
+			if !isHexID(tag[1]) {
+				continue
+			}
+			targetNode = NewUserNode(tag[1])
+			labelsRel = NewLabelsUserRel(
+				mapping.EventNode, targetNode, labelsProps)
+		case "a":
+			address, err := ParseAddress(tag[1])
+			if err != nil {
+				continue
+			}
+			targetNode = NewAddressNode(address)
+			labelsRel = NewLabelsAddressRel(
+				mapping.EventNode, targetNode, labelsProps)
+		case "r":
+			relayURL, ok := NormalizeRelayURL(tag[1])
+			if !ok {
+				continue
+			}
+			targetNode = NewRelayNode(relayURL)
+			labelsRel = NewLabelsRelayRel(
+				mapping.EventNode, targetNode, labelsProps)
+		default:
+			continue
+		}
+
+		mapping.Subgraph.AddNode(targetNode)
+		mapping.Subgraph.AddRel(labelsRel)
+	}
+
+	return mapping.Result()
+}
+
+// ========================================
+// Labels
+// ========================================
+
+// MapLabel links the event to the Label node of an "l" tag with a HAS_LABEL
+// relationship. The label's namespace is the tag's third element, or "ugc"
+// if it has none. On events other than label events, this is a self-label.
+func (m *EventMapping) MapLabel(tag nostr.Tag) {
+	namespace := ugcNamespace
+	if len(tag) > 2 && tag[2] != "" {
+		namespace = tag[2]
+	}
+
+	if len(namespace)+len(tag[1]) > maxTagSize {
+		m.Reject(tag, ReasonOversizedTag, nil)
+		return
+	}
+
+	labelNode := NewLabelNode(namespace, tag[1])
+	labelRel := NewHasLabelRel(m.EventNode, labelNode, nil)
+
+	m.Subgraph.AddNode(labelNode)
+	m.Subgraph.AddRel(labelRel)
+}
@@ -0,0 +1,367 @@
+// This module defines the interface for mapping nostr events to graph
+// entities and a registry for selecting a mapper by event kind.
+
+package lib
+
+import (
+	"regexp"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ========================================
+// Event Mapper
+// ========================================
+
+// EventMapper defines a method for mapping a nostr event to the nodes and
+// relationships that represent it in the graph.
+type EventMapper interface {
+	// Map returns the subgraph for the event and any tags that were rejected
+	// while mapping it. A nil subgraph skips the event, which is then not
+	// merged into the graph.
+	Map(event nostr.Event) (*Subgraph, []TagRejection)
+}
+
+// EventMapperFunc adapts an ordinary function to the EventMapper interface.
+type EventMapperFunc func(event nostr.Event) (*Subgraph, []TagRejection)
+
+func (f EventMapperFunc) Map(
+	event nostr.Event) (*Subgraph, []TagRejection) {
+	return f(event)
+}
+
+// TagRejection describes a tag that was dropped while mapping an event.
+type TagRejection struct {
+	// The rejected tag.
+	Tag nostr.Tag
+	// The reason the tag was rejected.
+	Reason RejectReason
+	// The underlying error, if any.
+	Err error
+}
+
+// ========================================
+// Mapper Registry
+// ========================================
+
+// MapperRegistry selects an event mapper by event kind. Mappers registered
+// for a single kind take precedence over mappers registered for a kind range,
+// and the fallback mapper is used for kinds with no registered mapper. The
+// registry is itself an EventMapper.
+type MapperRegistry struct {
+	// Mappers registered for a single kind.
+	kinds map[int]EventMapper
+	// Mappers registered for a range of kinds, in registration order.
+	ranges []kindRangeMapper
+	// The mapper used when no other mapper matches.
+	fallback EventMapper
+}
+
+// kindRangeMapper is a mapper registered for an inclusive range of kinds.
+type kindRangeMapper struct {
+	min    int
+	max    int
+	mapper EventMapper
+}
+
+// NewMapperRegistry creates an empty registry with the given fallback mapper.
+func NewMapperRegistry(fallback EventMapper) *MapperRegistry {
+	return &MapperRegistry{
+		kinds:    make(map[int]EventMapper),
+		ranges:   []kindRangeMapper{},
+		fallback: fallback,
+	}
+}
+
+// MapperOptions configures the mappers in the default registry.
+type MapperOptions struct {
+	// Whether to link every profile metadata event to its author with a
+	// HAD_PROFILE relationship.
+	ProfileHistory bool
+	// Whether to extract hashtags from the content of text notes.
+	ContentHashtags bool
+	// How deletion requests are applied to their targets. Deleted events are
+	// marked if unset.
+	DeletionPolicy DeletionPolicy
+}
+
+// NewDefaultMapperRegistry creates a registry with the mappers for all
+// supported event kinds.
+func NewDefaultMapperRegistry(opts MapperOptions) *MapperRegistry {
+	registry := NewMapperRegistry(DefaultMapper{})
+	registry.Register(nostr.KindProfileMetadata, ProfileMetadataMapper{
+		KeepHistory: opts.ProfileHistory,
+	})
+	registry.Register(nostr.KindTextNote, TextNoteMapper{
+		ContentHashtags: opts.ContentHashtags,
+	})
+	registry.Register(nostr.KindFollowList, FollowListMapper{})
+	registry.Register(nostr.KindDeletion, DeletionMapper{
+		Policy: opts.DeletionPolicy,
+	})
+	registry.Register(nostr.KindRepost, RepostMapper{})
+	registry.Register(nostr.KindReaction, ReactionMapper{})
+	registry.Register(nostr.KindBadgeAward, BadgeAwardMapper{})
+	registry.Register(nostr.KindGenericRepost, RepostMapper{})
+	registry.Register(nostr.KindReporting, ReportMapper{})
+	registry.Register(nostr.KindLabel, LabelMapper{})
+	registry.Register(nostr.KindZap, ZapReceiptMapper{})
+	registry.Register(nostr.KindMuteList, MuteListMapper{})
+	registry.Register(nostr.KindRelayListMetadata, RelayListMapper{})
+	registry.Register(nostr.KindProfileBadges, ProfileBadgesMapper{})
+	registry.Register(nostr.KindBadgeDefinition, BadgeDefinitionMapper{})
+	return registry
+}
+
+// Register sets the mapper for a single event kind, replacing any mapper
+// previously registered for it.
+func (r *MapperRegistry) Register(kind int, mapper EventMapper) {
+	r.kinds[kind] = mapper
+}
+
+// RegisterRange sets the mapper for the inclusive range of event kinds from
+// min to max. Where ranges overlap, the most recently registered range wins.
+func (r *MapperRegistry) RegisterRange(min int, max int, mapper EventMapper) {
+	r.ranges = append(r.ranges, kindRangeMapper{
+		min:    min,
+		max:    max,
+		mapper: mapper,
+	})
+}
+
+// Lookup returns the mapper for the given event kind.
+func (r *MapperRegistry) Lookup(kind int) EventMapper {
+	if mapper, exists := r.kinds[kind]; exists {
+		return mapper
+	}
+
+	for i := len(r.ranges) - 1; i >= 0; i-- {
+		if r.ranges[i].min <= kind && kind <= r.ranges[i].max {
+			return r.ranges[i].mapper
+		}
+	}
+
+	return r.fallback
+}
+
+func (r *MapperRegistry) Map(
+	event nostr.Event) (*Subgraph, []TagRejection) {
+	return r.Lookup(event.Kind).Map(event)
+}
+
+// ========================================
+// Event Mapping
+// ========================================
+
+// EventMapping accumulates the subgraph mapped from a single event. Mappers
+// use it to build on the author and Event nodes shared by every event.
+type EventMapping struct {
+	// The event being mapped.
+	Event nostr.Event
+	// The subgraph mapped so far.
+	Subgraph *Subgraph
+	// The User node of the event's author.
+	Author *Node
+	// The Event node of the event.
+	EventNode *Node
+	// The tags rejected so far.
+	Rejections []TagRejection
+}
+
+// NewEventMapping creates a mapping containing the event's author, its Event
+// node, and the SIGNED relationship between them. Addressable events are also
+// linked to their address, users, events, and addresses mentioned in the
+// content are linked as mentions, and any deletion requests received before
+// the event are applied to it.
+func NewEventMapping(event nostr.Event) *EventMapping {
+	subgraph := NewSubgraph()
+
+	userNode := NewUserNode(event.PubKey)
+	eventNode := NewEventNode(event.ID)
+
+	eventNode.Props["created_at"] = event.CreatedAt.Time().Unix()
+	eventNode.Props["kind"] = event.Kind
+	eventNode.Props["content"] = event.Content
+
+	authorRel := NewSignedRel(userNode, eventNode, nil)
+
+	subgraph.AddNode(userNode)
+	subgraph.AddNode(eventNode)
+	subgraph.AddRel(authorRel)
+	subgraph.AddStatement(NewApplyDeletionsStatement(event.ID))
+
+	mapping := &EventMapping{
+		Event:      event,
+		Subgraph:   subgraph,
+		Author:     userNode,
+		EventNode:  eventNode,
+		Rejections: []TagRejection{},
+	}
+	mapping.MapAddress()
+	mapping.MapContentMentions()
+
+	return mapping
+}
+
+// Reject records a tag that was dropped from the mapping.
+func (m *EventMapping) Reject(tag nostr.Tag, reason RejectReason, err error) {
+	m.Rejections = append(m.Rejections, TagRejection{
+		Tag:    tag,
+		Reason: reason,
+		Err:    err,
+	})
+}
+
+// Result returns the mapped subgraph and rejected tags.
+func (m *EventMapping) Result() (*Subgraph, []TagRejection) {
+	return m.Subgraph, m.Rejections
+}
+
+// MapTags maps each of the event's tags with the default tag mapping. Tags
+// for which skip returns true are left to the caller. Tags that are too large
+// for the Neo4j indexer are rejected. Relay hints are mapped for all tags,
+// including skipped ones.
+func (m *EventMapping) MapTags(skip func(tag nostr.Tag) bool) {
+	for _, tag := range m.Event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+
+		if len(tag[0])+len(tag[1]) > maxTagSize {
+			// Skip tags that are too large for the neo4j indexer
+			m.Reject(tag, ReasonOversizedTag, nil)
+			continue
+		}
+
+		m.MapRelayHint(tag)
+
+		if skip != nil && skip(tag) {
+			continue
+		}
+
+		m.MapTag(tag)
+	}
+}
+
+// MapTag maps a single tag with the default tag mapping. Event, user, and
+// address references become REFERENCES relationships, quoted events and
+// addresses become QUOTES relationships, hashtags become HAS_HASHTAG
+// relationships, labels become HAS_LABEL relationships, and all other tags
+// become Tag nodes.
+func (m *EventMapping) MapTag(tag nostr.Tag) {
+	name := tag[0]
+	value := tag[1]
+	var rest []string
+
+	if len(tag) > 2 {
+		rest = append([]string{}, tag[2:]...)
+	}
+
+	if name == "e" && isHexID(value) {
+		// Tag is an event reference
+		// Create a relationship to the referenced event
+		referencedEventNode := NewEventNode(value)
+		referencesRel := NewReferencesEventRel(
+			m.EventNode,
+			referencedEventNode,
+			map[string]any{
+				"name":  name,
+				"value": value,
+				"rest":  rest,
+			})
+		m.Subgraph.AddNode(referencedEventNode)
+		m.Subgraph.AddRel(referencesRel)
+
+	} else if name == "p" && isHexID(value) {
+		// Tag is a user reference
+		// Create a relationship to the referenced user
+		referencedUserNode := NewUserNode(value)
+		referencesRel := NewReferencesUserRel(
+			m.EventNode,
+			referencedUserNode,
+			map[string]any{
+				"name":  name,
+				"value": value,
+				"rest":  rest,
+			})
+		m.Subgraph.AddNode(referencedUserNode)
+		m.Subgraph.AddRel(referencesRel)
+
+	} else if name == "q" && isHexID(value) {
+		// Tag is a quoted event
+		// Create a relationship to the quoted event
+		quotedEventNode := NewEventNode(value)
+		quotesRel := NewQuotesEventRel(m.EventNode, quotedEventNode, nil)
+		m.Subgraph.AddNode(quotedEventNode)
+		m.Subgraph.AddRel(quotesRel)
+
+	} else if address, err := ParseAddress(value); name == "q" && err == nil {
+		// Tag is a quoted address
+		// Create a relationship to the quoted address
+		quotedAddressNode := NewAddressNode(address)
+		quotesRel := NewQuotesAddressRel(m.EventNode, quotedAddressNode, nil)
+		m.Subgraph.AddNode(quotedAddressNode)
+		m.Subgraph.AddRel(quotesRel)
+
+	} else if name == "l" {
+		// Tag is a label
+		m.MapLabel(tag)
+
+	} else if name == "t" {
+		// Tag is a hashtag
+		m.MapHashtag(value, "tag")
+
+	} else if address, err := ParseAddress(value); name == "a" && err == nil {
+		// Tag is an address reference
+		// Create a relationship to the referenced address
+		referencedAddressNode := NewAddressNode(address)
+		referencesRel := NewReferencesAddressRel(
+			m.EventNode,
+			referencedAddressNode,
+			map[string]any{
+				"name":  name,
+				"value": value,
+				"rest":  rest,
+			})
+		m.Subgraph.AddNode(referencedAddressNode)
+		m.Subgraph.AddRel(referencesRel)
+
+	} else {
+		// Generic Tag
+		tagNode := NewTagNode(name, value, rest)
+		tagRel := NewTaggedRel(m.EventNode, tagNode, nil)
+		m.Subgraph.AddNode(tagNode)
+		m.Subgraph.AddRel(tagRel)
+	}
+}
+
+// ========================================
+// Default Mapper
+// ========================================
+
+// DefaultMapper maps an event to its author, its Event node, and the default
+// mapping of its tags.
+type DefaultMapper struct{}
+
+func (DefaultMapper) Map(event nostr.Event) (*Subgraph, []TagRejection) {
+	mapping := NewEventMapping(event)
+	mapping.MapTags(nil)
+	return mapping.Result()
+}
+
+// ========================================
+// Helpers
+// ========================================
+
+// maxTagSize is the largest combined size of a tag's name and value that the
+// Neo4j indexer accepts.
+const maxTagSize = 8192
+
+// hexIDPattern matches 32-byte lowercase hex strings such as event ids and
+// pubkeys.
+var hexIDPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// isHexID reports whether the value is a 32-byte lowercase hex string.
+func isHexID(value string) bool {
+	return len(value) == 64 && hexIDPattern.MatchString(value)
+}
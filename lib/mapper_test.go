@@ -0,0 +1,52 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// namedMapper is a mapper that can be told apart from others by its name.
+type namedMapper struct {
+	name string
+}
+
+func (namedMapper) Map(event nostr.Event) (*Subgraph, []TagRejection) {
+	return NewSubgraph(), nil
+}
+
+func TestMapperRegistryLookup(t *testing.T) {
+	fallback := namedMapper{"fallback"}
+	registry := NewMapperRegistry(fallback)
+	registry.RegisterRange(10000, 19999, namedMapper{"replaceable"})
+	registry.RegisterRange(10000, 10999, namedMapper{"narrow"})
+	registry.RegisterRange(30000, 39999, namedMapper{"addressable"})
+	registry.Register(10002, namedMapper{"relays"})
+	registry.Register(1, namedMapper{"first"})
+	registry.Register(1, namedMapper{"note"})
+
+	tests := []struct {
+		name string
+		kind int
+		want string
+	}{
+		{"single kind", 1, "note"},
+		{"single kind within ranges", 10002, "relays"},
+		{"latest overlapping range", 10001, "narrow"},
+		{"earlier overlapping range", 11000, "replaceable"},
+		{"range lower bound", 30000, "addressable"},
+		{"range upper bound", 39999, "addressable"},
+		{"below range", 9999, "fallback"},
+		{"above range", 40000, "fallback"},
+		{"unregistered kind", 7, "fallback"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := registry.Lookup(tt.kind).(namedMapper)
+			if !ok || got.name != tt.want {
+				t.Errorf("Lookup(%d) = %v, want %s", tt.kind, got, tt.want)
+			}
+		})
+	}
+}
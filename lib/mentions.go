@@ -0,0 +1,109 @@
+// This module provides the mapping for NIP-27 inline mentions in event
+// content.
+
+package lib
+
+import (
+	"regexp"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// ========================================
+// Content Mentions
+// ========================================
+
+// contentMentionPattern matches nostr: URIs of NIP-19 entities that can be
+// mentioned in event content.
+var contentMentionPattern = regexp.MustCompile(
+	`nostr:((?:npub|note|nevent|nprofile|naddr)1[02-9ac-hj-np-z]+)`)
+
+// MapContentMentions links the event to each user, event, and address
+// mentioned in its content with a MENTIONS relationship. Relay hints of
+// nprofile and nevent mentions are linked to the mentioned user or event with
+// HINTED_AT relationships. Mentions that cannot be decoded are ignored.
+func (m *EventMapping) MapContentMentions() {
+	matches := contentMentionPattern.FindAllStringSubmatch(m.Event.Content, -1)
+	for _, match := range matches {
+		prefix, value, err := nip19.Decode(match[1])
+		if err != nil {
+			continue
+		}
+
+		switch pointer := value.(type) {
+		case string:
+			// npub and note decode to bare hex
+			if prefix == "npub" {
+				m.mapUserMention(pointer, nil)
+			} else {
+				m.mapEventMention(pointer, nil)
+			}
+		case nostr.ProfilePointer:
+			m.mapUserMention(pointer.PublicKey, pointer.Relays)
+		case nostr.EventPointer:
+			m.mapEventMention(pointer.ID, pointer.Relays)
+		case nostr.EntityPointer:
+			m.mapAddressMention(Address{
+				Kind:       pointer.Kind,
+				PubKey:     pointer.PublicKey,
+				Identifier: pointer.Identifier,
+			})
+		}
+	}
+}
+
+// mapUserMention links the event to a mentioned user and the user to its
+// relay hints.
+func (m *EventMapping) mapUserMention(pubkey string, relays []string) {
+	if !isHexID(pubkey) {
+		return
+	}
+
+	userNode := NewUserNode(pubkey)
+	mentionRel := NewMentionsUserRel(m.EventNode, userNode, nil)
+
+	m.Subgraph.AddNode(userNode)
+	m.Subgraph.AddRel(mentionRel)
+
+	for _, relay := range relays {
+		m.MapRelayHint(nostr.Tag{"p", pubkey, relay})
+	}
+}
+
+// mapEventMention links the event to a mentioned event and the mentioned
+// event to its relay hints.
+func (m *EventMapping) mapEventMention(id string, relays []string) {
+	if !isHexID(id) {
+		return
+	}
+
+	eventNode := NewEventNode(id)
+	mentionRel := NewMentionsEventRel(m.EventNode, eventNode, nil)
+
+	m.Subgraph.AddNode(eventNode)
+	m.Subgraph.AddRel(mentionRel)
+
+	for _, relay := range relays {
+		m.MapRelayHint(nostr.Tag{"e", id, relay})
+	}
+}
+
+// mapAddressMention links the event to a mentioned address.
+func (m *EventMapping) mapAddressMention(address Address) {
+	coordinate := address.String()
+	if len(coordinate) > maxTagSize {
+		return
+	}
+
+	address, err := ParseAddress(coordinate)
+	if err != nil {
+		return
+	}
+
+	addressNode := NewAddressNode(address)
+	mentionRel := NewMentionsAddressRel(m.EventNode, addressNode, nil)
+
+	m.Subgraph.AddNode(addressNode)
+	m.Subgraph.AddRel(mentionRel)
+}
@@ -0,0 +1,126 @@
+// This module provides the mapping for NIP-56 reports and NIP-51 mute lists.
+
+package lib
+
+import (
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ========================================
+// Report Mapper
+// ========================================
+
+// ReportMapper maps a kind 1984 report to REPORTED relationships from its
+// author to each reported user and event. The report type given in the
+// third position of the "p" or "e" tag is kept as the reason.
+type ReportMapper struct{}
+
+func (ReportMapper) Map(event nostr.Event) (*Subgraph, []TagRejection) {
+	mapping := NewEventMapping(event)
+	mapping.MapTags(nil)
+
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || !isHexID(tag[1]) {
+			continue
+		}
+
+		reportProps := Properties{
+			"report_id":  event.ID,
+			"created_at": event.CreatedAt.Time().Unix(),
+		}
+		if len(tag) > 2 && tag[2] != "" {
+			reportProps["reason"] = tag[2]
+		}
+
+		switch tag[0] {
+		case "p":
+			reportedNode := NewUserNode(tag[1])
+			reportedRel := NewReportedUserRel(
+				mapping.Author, reportedNode, reportProps)
+			mapping.Subgraph.AddNode(reportedNode)
+			mapping.Subgraph.AddRel(reportedRel)
+		case "e":
+			reportedNode := NewEventNode(tag[1])
+			reportedRel := NewReportedEventRel(
+				mapping.Author, reportedNode, reportProps)
+			mapping.Subgraph.AddNode(reportedNode)
+			mapping.Subgraph.AddRel(reportedRel)
+		}
+	}
+
+	return mapping.Result()
+}
+
+// ========================================
+// Mute List Mapper
+// ========================================
+
+// MuteListMapper maps a kind 10000 mute list to MUTES relationships from its
+// author to each publicly muted user. Because mute lists are replaceable,
+// only the newest list seen for an author is applied, and applying it removes
+// any MUTES relationships not present in the list. Privately muted users are
+// encrypted in the content and are not mapped.
+type MuteListMapper struct{}
+
+func (MuteListMapper) Map(event nostr.Event) (*Subgraph, []TagRejection) {
+	mapping := NewEventMapping(event)
+
+	mutes := NewSet[string]()
+
+	mapping.MapTags(func(tag nostr.Tag) bool {
+		if tag[0] != "p" || !isHexID(tag[1]) {
+			return false
+		}
+
+		mutes.Add(tag[1])
+		mapping.Subgraph.AddNode(NewUserNode(tag[1]))
+		return true
+	})
+
+	mapping.Subgraph.AddStatement(NewReplaceMutesStatement(
+		event.PubKey,
+		event.ID,
+		event.CreatedAt.Time().Unix(),
+		mutes.ToArray(),
+	))
+
+	return mapping.Result()
+}
+
+// ========================================
+// Statements
+// ========================================
+
+// replaceMutesQuery replaces a user's MUTES relationships with those of their
+// newest mute list.
+var replaceMutesQuery = newestWinsQuery("u", "User", "pubkey", "mutes") + `
+	CALL {
+		WITH u, row
+		MATCH (u)-[r:MUTES]->(m:User)
+		WHERE NOT m.pubkey IN row.mutes
+		DELETE r
+	}
+
+	WITH u, row
+	UNWIND row.mutes AS pubkey
+	MATCH (m:User { pubkey: pubkey })
+	MERGE (u)-[r:MUTES]->(m)
+	SET r.created_at = row.created_at
+	`
+
+// NewReplaceMutesStatement creates a statement that replaces the MUTES
+// relationships of the given user with the users of their mute list, if the
+// list is the newest seen.
+func NewReplaceMutesStatement(
+	pubkey string,
+	id string,
+	createdAt int64,
+	mutes []string,
+) *Statement {
+	return NewStatement(replaceMutesQuery, Properties{
+		"pubkey":     pubkey,
+		"id":         id,
+		"created_at": createdAt,
+		"mutes":      mutes,
+	})
+}
@@ -0,0 +1,122 @@
+// This module provides the mapping for NIP-01 profile metadata.
+
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ========================================
+// Profile Metadata Mapper
+// ========================================
+
+// profileFields are the profile metadata fields projected onto User nodes.
+var profileFields = []string{
+	"name",
+	"display_name",
+	"about",
+	"picture",
+	"banner",
+	"website",
+	"nip05",
+	"lud06",
+	"lud16",
+	"bot",
+}
+
+// ProfileMetadataMapper maps a kind 0 profile metadata event by projecting the
+// fields of its JSON content onto the author's User node. Only the newest
+// metadata seen for an author is applied. If KeepHistory is set, every
+// metadata event is also linked to its author with a HAD_PROFILE
+// relationship.
+type ProfileMetadataMapper struct {
+	// Whether to link metadata events to their author as profile history.
+	KeepHistory bool
+}
+
+func (m ProfileMetadataMapper) Map(
+	event nostr.Event) (*Subgraph, []TagRejection) {
+
+	mapping := NewEventMapping(event)
+	mapping.MapTags(nil)
+
+	profile, err := parseProfile(event.Content)
+	if err != nil {
+		mapping.Reject(nil, ReasonInvalidMetadata, err)
+		return mapping.Result()
+	}
+
+	mapping.Subgraph.AddStatement(NewReplaceProfileStatement(
+		event.PubKey,
+		event.ID,
+		event.CreatedAt.Time().Unix(),
+		profile,
+	))
+
+	if m.KeepHistory {
+		historyRel := NewHadProfileRel(
+			mapping.Author,
+			mapping.EventNode,
+			Properties{"created_at": event.CreatedAt.Time().Unix()})
+		mapping.Subgraph.AddRel(historyRel)
+	}
+
+	return mapping.Result()
+}
+
+// parseProfile returns the known profile fields of the metadata content.
+// Empty strings and values of unexpected types are omitted.
+func parseProfile(content string) (Properties, error) {
+	metadata := map[string]any{}
+	if err := json.Unmarshal([]byte(content), &metadata); err != nil {
+		return nil, fmt.Errorf("invalid metadata content: %w", err)
+	}
+
+	profile := make(Properties)
+	for _, field := range profileFields {
+		switch value := metadata[field].(type) {
+		case string:
+			if value = strings.TrimSpace(value); value != "" {
+				profile[field] = value
+			}
+		case bool:
+			profile[field] = value
+		}
+	}
+
+	return profile, nil
+}
+
+// ========================================
+// Statements
+// ========================================
+
+// replaceProfileQuery replaces the profile fields on a user with those of
+// their newest metadata event.
+var replaceProfileQuery = newestWinsQuery("u", "User", "pubkey", "profile") +
+	fmt.Sprintf(`
+	REMOVE %s
+	SET u += row.profile
+	`,
+		"u."+strings.Join(profileFields, ", u."),
+	)
+
+// NewReplaceProfileStatement creates a statement that sets the given profile
+// fields on a user, if the metadata event is the newest seen.
+func NewReplaceProfileStatement(
+	pubkey string,
+	id string,
+	createdAt int64,
+	profile Properties,
+) *Statement {
+	return NewStatement(replaceProfileQuery, Properties{
+		"pubkey":     pubkey,
+		"id":         id,
+		"created_at": createdAt,
+		"profile":    profile,
+	})
+}
@@ -0,0 +1,210 @@
+// This module provides a dead-letter output for events and tags rejected
+// during an import.
+
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ========================================
+// Rejection Reasons
+// ========================================
+
+// RejectReason is a machine-readable code describing why an event or tag was
+// rejected.
+type RejectReason string
+
+const (
+	// The input line exceeds the maximum line size.
+	ReasonLineTooLong RejectReason = "line_too_long"
+	// The input line is not a valid JSON event.
+	ReasonInvalidJSON RejectReason = "invalid_json"
+	// The pubkey is not a 32-byte lowercase hex string.
+	ReasonInvalidPubkey RejectReason = "invalid_pubkey"
+	// The id does not match the hash of the event's NIP-01 serialization.
+	ReasonInvalidID RejectReason = "invalid_id"
+	// The signature is malformed or does not verify against the pubkey.
+	ReasonInvalidSignature RejectReason = "invalid_signature"
+	// The tag is too large for the Neo4j indexer.
+	ReasonOversizedTag RejectReason = "oversized_tag"
+	// The bolt11 invoice of a zap receipt could not be decoded.
+	ReasonInvalidBolt11 RejectReason = "invalid_bolt11"
+	// The zap request in a zap receipt's description is invalid or does not
+	// match the receipt.
+	ReasonInvalidZapRequest RejectReason = "invalid_zap_request"
+	// The description hash of a zap receipt's invoice does not match its zap
+	// request.
+	ReasonDescriptionHashMismatch RejectReason = "description_hash_mismatch"
+	// The content of a profile metadata event is not a JSON object.
+	ReasonInvalidMetadata RejectReason = "invalid_metadata"
+	// The subgraph mapped from the event has an invalid node or relationship.
+	ReasonInvalidSubgraph RejectReason = "invalid_subgraph"
+	// The batch containing the event could not be merged into the graph.
+	ReasonMergeFailed RejectReason = "merge_failed"
+)
+
+// ========================================
+// Sourced Events
+// ========================================
+
+// SourcedEvent is an event together with the position in the input it was
+// read from.
+type SourcedEvent struct {
+	// The event.
+	Event nostr.Event
+	// The name of the input source.
+	Source string
+	// The line number within the input source.
+	Line int
+	// The byte offset in the decompressed input source of the start of the
+	// line.
+	LineOffset int64
+	// The byte offset in the decompressed input source just past the line.
+	Offset int64
+}
+
+// ========================================
+// Quarantine
+// ========================================
+
+// QuarantineRecord is a single line of dead-letter output.
+type QuarantineRecord struct {
+	// The reason the event or tag was rejected.
+	Reason RejectReason `json:"reason"`
+	// The underlying error message, if any.
+	Error string `json:"error,omitempty"`
+	// The name of the input source.
+	Source string `json:"source"`
+	// The line number within the input source.
+	Line int `json:"line"`
+	// The raw input line, for lines that could not be parsed.
+	Raw string `json:"raw,omitempty"`
+	// The rejected event, or the event containing the rejected tag.
+	Event *nostr.Event `json:"event,omitempty"`
+	// The rejected tag.
+	Tag nostr.Tag `json:"tag,omitempty"`
+}
+
+// Quarantine writes rejected events and tags to a dead-letter JSONL output.
+// It is safe for concurrent use.
+type Quarantine struct {
+	mu sync.Mutex
+	// The buffered output.
+	writer *bufio.Writer
+	// Closes the underlying output.
+	closer io.Closer
+}
+
+// NewQuarantine creates a quarantine that appends to the file at the given
+// path. If the path is empty, rejected records are discarded.
+func NewQuarantine(path string) (*Quarantine, error) {
+	if path == "" {
+		return &Quarantine{
+			writer: bufio.NewWriter(io.Discard),
+			closer: io.NopCloser(nil),
+		}, nil
+	}
+
+	file, err := os.OpenFile(
+		path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Quarantine{
+		writer: bufio.NewWriter(file),
+		closer: file,
+	}, nil
+}
+
+// Write appends a record to the dead-letter output.
+func (q *Quarantine) Write(record QuarantineRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, err := q.writer.Write(data); err != nil {
+		return err
+	}
+	return q.writer.WriteByte('\n')
+}
+
+// RejectLine records an input line that could not be parsed as an event.
+func (q *Quarantine) RejectLine(
+	source string, line int, raw []byte, reason RejectReason, err error) error {
+
+	return q.Write(QuarantineRecord{
+		Reason: reason,
+		Error:  errorString(err),
+		Source: source,
+		Line:   line,
+		Raw:    string(raw),
+	})
+}
+
+// RejectEvent records an event that was rejected as a whole.
+func (q *Quarantine) RejectEvent(
+	event SourcedEvent, reason RejectReason, err error) error {
+
+	return q.Write(QuarantineRecord{
+		Reason: reason,
+		Error:  errorString(err),
+		Source: event.Source,
+		Line:   event.Line,
+		Event:  &event.Event,
+	})
+}
+
+// RejectTag records a single tag that was dropped from an event. A nil tag
+// records that part of the event's content could not be mapped.
+func (q *Quarantine) RejectTag(
+	event SourcedEvent, tag nostr.Tag, reason RejectReason, err error) error {
+
+	return q.Write(QuarantineRecord{
+		Reason: reason,
+		Error:  errorString(err),
+		Source: event.Source,
+		Line:   event.Line,
+		Event:  &event.Event,
+		Tag:    tag,
+	})
+}
+
+// Flush writes buffered records to the output.
+func (q *Quarantine) Flush() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.writer.Flush()
+}
+
+// Close flushes buffered records and closes the output.
+func (q *Quarantine) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.writer.Flush(); err != nil {
+		q.closer.Close()
+		return err
+	}
+	return q.closer.Close()
+}
+
+// errorString returns the error message, or an empty string for a nil error.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
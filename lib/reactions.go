@@ -0,0 +1,129 @@
+// This module provides the mapping for NIP-25 reactions and NIP-18 reposts.
+
+package lib
+
+import (
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ========================================
+// Reaction Mapper
+// ========================================
+
+// ReactionMapper maps a kind 7 reaction to a REACTED relationship from its
+// author to the event reacted to, which is the last "e" tag. Custom emoji
+// reactions also carry the emoji's shortcode and image URL.
+type ReactionMapper struct{}
+
+func (ReactionMapper) Map(event nostr.Event) (*Subgraph, []TagRejection) {
+	mapping := NewEventMapping(event)
+	mapping.MapTags(nil)
+
+	target := lastEventRef(event.Tags)
+	if target == "" {
+		return mapping.Result()
+	}
+
+	content := event.Content
+	if content == "" {
+		// An empty reaction is a like.
+		content = "+"
+	}
+
+	reactionProps := Properties{
+		"reaction_id": event.ID,
+		"content":     content,
+		"created_at":  event.CreatedAt.Time().Unix(),
+	}
+	if shortcode, url, ok := customEmoji(event); ok {
+		reactionProps["emoji_shortcode"] = shortcode
+		reactionProps["emoji_url"] = url
+	}
+
+	targetNode := NewEventNode(target)
+	reactedRel := NewReactedRel(mapping.Author, targetNode, reactionProps)
+
+	mapping.Subgraph.AddNode(targetNode)
+	mapping.Subgraph.AddRel(reactedRel)
+
+	return mapping.Result()
+}
+
+// customEmoji returns the shortcode and image URL of a reaction's custom
+// emoji, if its content is a :shortcode: with a matching "emoji" tag.
+func customEmoji(event nostr.Event) (string, string, bool) {
+	content := event.Content
+	if len(content) < 3 ||
+		!strings.HasPrefix(content, ":") ||
+		!strings.HasSuffix(content, ":") {
+		return "", "", false
+	}
+
+	shortcode := content[1 : len(content)-1]
+	for _, tag := range event.Tags {
+		if len(tag) >= 3 && tag[0] == "emoji" && tag[1] == shortcode {
+			return shortcode, tag[2], true
+		}
+	}
+
+	return "", "", false
+}
+
+// ========================================
+// Repost Mapper
+// ========================================
+
+// RepostMapper maps a kind 6 repost or kind 16 generic repost to a REPOSTED
+// relationship from its author to the reposted event, which is the first "e"
+// tag.
+type RepostMapper struct{}
+
+func (RepostMapper) Map(event nostr.Event) (*Subgraph, []TagRejection) {
+	mapping := NewEventMapping(event)
+	mapping.MapTags(nil)
+
+	target := firstEventRef(event.Tags)
+	if target == "" {
+		return mapping.Result()
+	}
+
+	targetNode := NewEventNode(target)
+	repostedRel := NewRepostedRel(
+		mapping.Author,
+		targetNode,
+		Properties{"created_at": event.CreatedAt.Time().Unix()})
+
+	mapping.Subgraph.AddNode(targetNode)
+	mapping.Subgraph.AddRel(repostedRel)
+
+	return mapping.Result()
+}
+
+// ========================================
+// Helpers
+// ========================================
+
+// firstEventRef returns the id of the first valid "e" tag, or an empty string
+// if there is none.
+func firstEventRef(tags nostr.Tags) string {
+	for _, tag := range tags {
+		if len(tag) >= 2 && tag[0] == "e" && isHexID(tag[1]) {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+// lastEventRef returns the id of the last valid "e" tag, or an empty string
+// if there is none.
+func lastEventRef(tags nostr.Tags) string {
+	for i := len(tags) - 1; i >= 0; i-- {
+		tag := tags[i]
+		if len(tag) >= 2 && tag[0] == "e" && isHexID(tag[1]) {
+			return tag[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,197 @@
+// This module provides the mapping for NIP-65 relay lists and relay hints.
+
+package lib
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ========================================
+// Relay List Mapper
+// ========================================
+
+// RelayListMapper maps a kind 10002 relay list to READS_FROM and WRITES_TO
+// relationships from its author to each listed relay. Relays without a marker
+// are both read from and written to. Because relay lists are replaceable,
+// only the newest list seen for an author is applied, and applying it removes
+// any relationships not present in the list.
+type RelayListMapper struct{}
+
+func (RelayListMapper) Map(event nostr.Event) (*Subgraph, []TagRejection) {
+	mapping := NewEventMapping(event)
+
+	read := NewSet[string]()
+	write := NewSet[string]()
+
+	mapping.MapTags(func(tag nostr.Tag) bool {
+		if tag[0] != "r" {
+			return false
+		}
+
+		relayURL, ok := NormalizeRelayURL(tag[1])
+		if !ok {
+			return false
+		}
+
+		marker := ""
+		if len(tag) > 2 {
+			marker = tag[2]
+		}
+		switch marker {
+		case "":
+			read.Add(relayURL)
+			write.Add(relayURL)
+		case "read":
+			read.Add(relayURL)
+		case "write":
+			write.Add(relayURL)
+		default:
+			return false
+		}
+
+		mapping.Subgraph.AddNode(NewRelayNode(relayURL))
+		return true
+	})
+
+	mapping.Subgraph.AddStatement(NewReplaceRelaysStatement(
+		event.PubKey,
+		event.ID,
+		event.CreatedAt.Time().Unix(),
+		read.ToArray(),
+		write.ToArray(),
+	))
+
+	return mapping.Result()
+}
+
+// ========================================
+// Relay Hints
+// ========================================
+
+// MapRelayHint links the user or event referenced by a "p", "e", or "q" tag
+// to the relay hinted in the tag's third position with a HINTED_AT
+// relationship.
+func (m *EventMapping) MapRelayHint(tag nostr.Tag) {
+	if len(tag) < 3 || !isHexID(tag[1]) {
+		return
+	}
+
+	relayURL, ok := NormalizeRelayURL(tag[2])
+	if !ok {
+		return
+	}
+
+	relayNode := NewRelayNode(relayURL)
+
+	var refNode *Node
+	var hintRel *Relationship
+	switch tag[0] {
+	case "e", "q":
+		refNode = NewEventNode(tag[1])
+		hintRel = NewHintedAtEventRel(refNode, relayNode, nil)
+	case "p":
+		refNode = NewUserNode(tag[1])
+		hintRel = NewHintedAtUserRel(refNode, relayNode, nil)
+	default:
+		return
+	}
+
+	m.Subgraph.AddNode(refNode)
+	m.Subgraph.AddNode(relayNode)
+	m.Subgraph.AddRel(hintRel)
+}
+
+// NormalizeRelayURL normalizes the scheme, host case, and trailing slash of a
+// relay URL. Returns false if the result is not a valid websocket URL or is
+// too large to be indexed.
+func NormalizeRelayURL(relayURL string) (string, bool) {
+	relayURL = strings.TrimSpace(relayURL)
+
+	// NormalizeURL only recognizes lowercase schemes, so the scheme and host
+	// are lowercased first.
+	if strings.Contains(relayURL, "://") {
+		parsed, err := url.Parse(relayURL)
+		if err != nil {
+			return "", false
+		}
+
+		switch parsed.Scheme {
+		case "ws", "wss", "http", "https":
+		default:
+			return "", false
+		}
+
+		parsed.Host = strings.ToLower(parsed.Host)
+		relayURL = parsed.String()
+	}
+
+	normalized := nostr.NormalizeURL(relayURL)
+	if normalized == "" || !nostr.IsValidRelayURL(normalized) {
+		return "", false
+	}
+
+	// A path starting with "//" is left by a doubled scheme, as in
+	// "wss://wss://relay.example.com".
+	parsed, err := url.Parse(normalized)
+	if err != nil ||
+		parsed.Host == "" ||
+		strings.HasPrefix(parsed.Path, "//") ||
+		len(normalized) > maxTagSize {
+		return "", false
+	}
+
+	return normalized, true
+}
+
+// ========================================
+// Statements
+// ========================================
+
+// replaceRelaysQuery replaces a user's READS_FROM and WRITES_TO relationships
+// with those of their newest relay list.
+var replaceRelaysQuery = newestWinsQuery("u", "User", "pubkey", "relays") + `
+	CALL {
+		WITH u, row
+		MATCH (u)-[r:READS_FROM|WRITES_TO]->(relay:Relay)
+		WHERE (type(r) = 'READS_FROM' AND NOT relay.url IN row.read)
+		   OR (type(r) = 'WRITES_TO' AND NOT relay.url IN row.write)
+		DELETE r
+	}
+
+	WITH u, row
+	CALL {
+		WITH u, row
+		UNWIND row.read AS url
+		MATCH (relay:Relay { url: url })
+		MERGE (u)-[r:READS_FROM]->(relay)
+		SET r.created_at = row.created_at
+	}
+
+	WITH u, row
+	UNWIND row.write AS url
+	MATCH (relay:Relay { url: url })
+	MERGE (u)-[r:WRITES_TO]->(relay)
+	SET r.created_at = row.created_at
+	`
+
+// NewReplaceRelaysStatement creates a statement that replaces the READS_FROM
+// and WRITES_TO relationships of the given user with the relays of their
+// relay list, if the list is the newest seen.
+func NewReplaceRelaysStatement(
+	pubkey string,
+	id string,
+	createdAt int64,
+	read []string,
+	write []string,
+) *Statement {
+	return NewStatement(replaceRelaysQuery, Properties{
+		"pubkey":     pubkey,
+		"id":         id,
+		"created_at": createdAt,
+		"read":       read,
+		"write":      write,
+	})
+}
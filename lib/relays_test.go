@@ -0,0 +1,40 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeRelayURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+		ok   bool
+	}{
+		{"wss://relay.example.com", "wss://relay.example.com", true},
+		{"wss://relay.example.com/", "wss://relay.example.com", true},
+		{"WSS://Relay.Example.com/", "wss://relay.example.com", true},
+		{" wss://relay.example.com ", "wss://relay.example.com", true},
+		{"relay.example.com", "wss://relay.example.com", true},
+		{"https://relay.example.com/path/", "wss://relay.example.com/path", true},
+		{"http://relay.example.com", "ws://relay.example.com", true},
+		{"ws://relay.example.com:7777", "ws://relay.example.com:7777", true},
+		{"wss://wss://relay.example.com", "", false},
+		{"WSS://wss://relay.example.com", "", false},
+		{"wss:///relay", "", false},
+		{"ftp://relay.example.com", "", false},
+		{"wss://", "", false},
+		{"", "", false},
+		{"wss://" + strings.Repeat("a", maxTagSize) + ".com", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, ok := NormalizeRelayURL(tt.url)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("NormalizeRelayURL(%q) = %q, %v, want %q, %v",
+					tt.url, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
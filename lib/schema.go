@@ -14,10 +14,28 @@ import (
 func NewMatchKeys() *MatchKeys {
 	return &MatchKeys{
 		keys: map[string][]string{
-			"User":  {"pubkey"},
-			"Relay": {"url"},
-			"Event": {"id"},
-			"Tag":   {"name", "value"},
+			"User":    {"pubkey"},
+			"Relay":   {"url"},
+			"Event":   {"id"},
+			"Tag":     {"name", "value"},
+			"Address": {"coordinate"},
+			"Hashtag": {"name"},
+			"Label":   {"namespace", "value"},
+			"Badge":   {"coordinate"},
+		},
+	}
+}
+
+// NewRelMatchKeys returns the relationship property keys used to distinguish
+// relationships of a given type between the same pair of nodes. Relationships
+// of types without match keys are merged into one per pair of nodes.
+func NewRelMatchKeys() *MatchKeys {
+	return &MatchKeys{
+		keys: map[string][]string{
+			"ZAPPED":     {"receipt_id"},
+			"REACTED":    {"reaction_id"},
+			"REPORTED":   {"report_id"},
+			"AWARDED_TO": {"award_id"},
 		},
 	}
 }
@@ -45,6 +63,31 @@ func NewTagNode(name string, value string, rest []string) *Node {
 		"rest":  rest})
 }
 
+func NewAddressNode(address Address) *Node {
+	return NewNode("Address", Properties{
+		"coordinate": address.String(),
+		"kind":       address.Kind,
+		"pubkey":     address.PubKey,
+		"d":          address.Identifier})
+}
+
+func NewHashtagNode(name string) *Node {
+	return NewNode("Hashtag", Properties{"name": name})
+}
+
+func NewLabelNode(namespace string, value string) *Node {
+	return NewNode("Label", Properties{
+		"namespace": namespace,
+		"value":     value})
+}
+
+func NewBadgeNode(address Address) *Node {
+	return NewNode("Badge", Properties{
+		"coordinate": address.String(),
+		"pubkey":     address.PubKey,
+		"d":          address.Identifier})
+}
+
 // ========================================
 // Relationship Constructors
 // ========================================
@@ -62,6 +105,42 @@ func NewTaggedRel(
 		"TAGGED", "Event", "Tag", start, end, props)
 }
 
+func NewHasHashtagRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"HAS_HASHTAG", "Event", "Hashtag", start, end, props)
+}
+
+func NewHasLabelRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"HAS_LABEL", "Event", "Label", start, end, props)
+}
+
+func NewLabelsEventRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"LABELS", "Event", "Event", start, end, props)
+}
+
+func NewLabelsUserRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"LABELS", "Event", "User", start, end, props)
+}
+
+func NewLabelsAddressRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"LABELS", "Event", "Address", start, end, props)
+}
+
+func NewLabelsRelayRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"LABELS", "Event", "Relay", start, end, props)
+}
+
 func NewReferencesEventRel(
 	start *Node, end *Node, props Properties) *Relationship {
 	return NewRelationshipWithValidation(
@@ -74,20 +153,157 @@ func NewReferencesUserRel(
 		"REFERENCES", "Event", "User", start, end, props)
 }
 
+func NewReferencesAddressRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"REFERENCES", "Event", "Address", start, end, props)
+}
+
+func NewVersionOfRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"VERSION_OF", "Event", "Address", start, end, props)
+}
+
+func NewQuotesEventRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"QUOTES", "Event", "Event", start, end, props)
+}
+
+func NewQuotesAddressRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"QUOTES", "Event", "Address", start, end, props)
+}
+
+func NewRepliesToRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"REPLIES_TO", "Event", "Event", start, end, props)
+}
+
+func NewRootOfThreadRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"ROOT_OF_THREAD", "Event", "Event", start, end, props)
+}
+
+func NewMentionsEventRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"MENTIONS", "Event", "Event", start, end, props)
+}
+
+func NewMentionsUserRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"MENTIONS", "Event", "User", start, end, props)
+}
+
+func NewMentionsAddressRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"MENTIONS", "Event", "Address", start, end, props)
+}
+
+func NewDeletesRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"DELETES", "Event", "Event", start, end, props)
+}
+
+func NewDeletesAddressRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"DELETES", "Event", "Address", start, end, props)
+}
+
+func NewZappedUserRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"ZAPPED", "User", "User", start, end, props)
+}
+
+func NewZappedEventRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"ZAPPED", "User", "Event", start, end, props)
+}
+
+func NewReactedRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"REACTED", "User", "Event", start, end, props)
+}
+
+func NewRepostedRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"REPOSTED", "User", "Event", start, end, props)
+}
+
+func NewReportedUserRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"REPORTED", "User", "User", start, end, props)
+}
+
+func NewReportedEventRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"REPORTED", "User", "Event", start, end, props)
+}
+
+func NewIssuedRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"ISSUED", "User", "Badge", start, end, props)
+}
+
+func NewAwardedToRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"AWARDED_TO", "Badge", "User", start, end, props)
+}
+
+func NewHadProfileRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"HAD_PROFILE", "User", "Event", start, end, props)
+}
+
+func NewHintedAtEventRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"HINTED_AT", "Event", "Relay", start, end, props)
+}
+
+func NewHintedAtUserRel(
+	start *Node, end *Node, props Properties) *Relationship {
+	return NewRelationshipWithValidation(
+		"HINTED_AT", "User", "Relay", start, end, props)
+}
+
 // ========================================
 // Relationship Constructor Helpers
 // ========================================
 
-func validateNodeLabel(node *Node, role string, expectedLabel string) {
+// validateNodeLabel returns an error if the node does not have the expected
+// label.
+func validateNodeLabel(node *Node, role string, expectedLabel string) error {
 	if !node.Labels.Contains(expectedLabel) {
-		panic(fmt.Errorf(
+		return fmt.Errorf(
 			"expected %s node to have label '%s'. got %v",
 			role, expectedLabel, node.Labels.ToArray(),
-		),
 		)
 	}
+	return nil
 }
 
+// NewRelationshipWithValidation creates a relationship that requires its
+// start and end nodes to have the given labels. The labels are validated when
+// the relationship is added to a structured subgraph.
 func NewRelationshipWithValidation(
 	rtype string,
 	startLabel string,
@@ -96,8 +312,8 @@ func NewRelationshipWithValidation(
 	end *Node,
 	props Properties) *Relationship {
 
-	validateNodeLabel(start, "start", startLabel)
-	validateNodeLabel(end, "end", endLabel)
-
-	return NewRelationship(rtype, start, end, props)
+	rel := NewRelationship(rtype, start, end, props)
+	rel.StartLabel = startLabel
+	rel.EndLabel = endLabel
+	return rel
 }
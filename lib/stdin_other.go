@@ -0,0 +1,17 @@
+//go:build !unix
+
+// This module opens standard input on platforms where a blocked read cannot
+// be interrupted.
+
+package lib
+
+import (
+	"io"
+	"os"
+)
+
+// openStdin returns standard input. Reads blocked waiting for input are not
+// interrupted by closing it.
+func openStdin() (io.ReadCloser, error) {
+	return io.NopCloser(os.Stdin), nil
+}
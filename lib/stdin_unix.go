@@ -0,0 +1,42 @@
+//go:build unix
+
+// This module opens standard input so that a blocked read can be interrupted
+// by closing it.
+
+package lib
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// openStdin opens a duplicate of standard input in non-blocking mode, which
+// lets the runtime poll it. Closing the returned reader then interrupts a
+// read waiting for input from an idle pipe or terminal.
+func openStdin() (io.ReadCloser, error) {
+	fd, err := syscall.Dup(syscall.Stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	return &stdinReader{os.NewFile(uintptr(fd), "stdin")}, nil
+}
+
+// stdinReader is a non-blocking duplicate of standard input.
+type stdinReader struct {
+	*os.File
+}
+
+// Close closes the duplicate and restores blocking mode, which the duplicate
+// shares with standard input, so that other readers are not affected.
+func (r *stdinReader) Close() error {
+	err := r.File.Close()
+	syscall.SetNonblock(syscall.Stdin, false)
+	return err
+}
@@ -0,0 +1,153 @@
+// This module provides the mapping for NIP-10 text note threads.
+
+package lib
+
+import (
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ========================================
+// Text Note Mapper
+// ========================================
+
+// TextNoteMapper maps a kind 1 text note, interpreting its event references
+// as NIP-10 thread structure. The thread root is linked to the note with a
+// ROOT_OF_THREAD relationship, the note is linked to its parent with a
+// REPLIES_TO relationship, and other referenced events are linked with
+// MENTIONS relationships. Event references also keep their REFERENCES
+// relationships, as on every other kind. If ContentHashtags is set, hashtags
+// in the note's content are also mapped.
+type TextNoteMapper struct {
+	// Whether to extract hashtags from the note's content.
+	ContentHashtags bool
+}
+
+func (m TextNoteMapper) Map(event nostr.Event) (*Subgraph, []TagRejection) {
+	mapping := NewEventMapping(event)
+
+	mapping.MapTags(nil)
+
+	if m.ContentHashtags {
+		mapping.MapContentHashtags()
+	}
+
+	for _, ref := range ParseThreadRefs(event.Tags) {
+		refNode := NewEventNode(ref.ID)
+		mapping.Subgraph.AddNode(refNode)
+
+		switch ref.Marker {
+		case MarkerRoot:
+			rootRel := NewRootOfThreadRel(refNode, mapping.EventNode, nil)
+			mapping.Subgraph.AddRel(rootRel)
+		case MarkerReply:
+			replyRel := NewRepliesToRel(mapping.EventNode, refNode, nil)
+			mapping.Subgraph.AddRel(replyRel)
+		case MarkerMention:
+			mentionRel := NewMentionsEventRel(mapping.EventNode, refNode, nil)
+			mapping.Subgraph.AddRel(mentionRel)
+		}
+	}
+
+	return mapping.Result()
+}
+
+// ========================================
+// Thread References
+// ========================================
+
+// ThreadMarker is the role of an event reference in a NIP-10 thread.
+type ThreadMarker string
+
+const (
+	// The referenced event is the root of the thread.
+	MarkerRoot ThreadMarker = "root"
+	// The referenced event is the direct parent of the reply.
+	MarkerReply ThreadMarker = "reply"
+	// The referenced event is mentioned but not part of the thread.
+	MarkerMention ThreadMarker = "mention"
+)
+
+// ThreadRef is an event reference and its role in a thread.
+type ThreadRef struct {
+	// The id of the referenced event.
+	ID string
+	// The role of the referenced event.
+	Marker ThreadMarker
+}
+
+// ParseThreadRefs returns the thread role of each event reference in the
+// tags. Marked "e" tags are interpreted by their marker, and a reply with a
+// root but no parent is a direct reply to the root. If no tag is marked, the
+// deprecated positional convention applies: the first reference is the root,
+// the last is the parent, and any others are mentions.
+func ParseThreadRefs(tags nostr.Tags) []ThreadRef {
+	eventTags := []nostr.Tag{}
+	marked := false
+
+	for _, tag := range tags {
+		if len(tag) < 2 || tag[0] != "e" || !isHexID(tag[1]) {
+			continue
+		}
+		eventTags = append(eventTags, tag)
+		if threadMarker(tag) != "" {
+			marked = true
+		}
+	}
+
+	refs := []ThreadRef{}
+
+	if marked {
+		var root string
+		hasReply := false
+
+		for _, tag := range eventTags {
+			marker := threadMarker(tag)
+			if marker == "" {
+				// Unmarked references alongside marked ones are mentions.
+				marker = MarkerMention
+			}
+			if marker == MarkerRoot {
+				root = tag[1]
+			}
+			if marker == MarkerReply {
+				hasReply = true
+			}
+			refs = append(refs, ThreadRef{ID: tag[1], Marker: marker})
+		}
+
+		if root != "" && !hasReply {
+			refs = append(refs, ThreadRef{ID: root, Marker: MarkerReply})
+		}
+
+		return refs
+	}
+
+	for i, tag := range eventTags {
+		if i == 0 {
+			refs = append(refs, ThreadRef{ID: tag[1], Marker: MarkerRoot})
+		}
+		if i == len(eventTags)-1 {
+			refs = append(refs, ThreadRef{ID: tag[1], Marker: MarkerReply})
+		}
+		if i != 0 && i != len(eventTags)-1 {
+			refs = append(refs, ThreadRef{ID: tag[1], Marker: MarkerMention})
+		}
+	}
+
+	return refs
+}
+
+// threadMarker returns the NIP-10 marker of an "e" tag, or an empty string if
+// the tag has no recognized marker.
+func threadMarker(tag nostr.Tag) ThreadMarker {
+	if len(tag) < 4 {
+		return ""
+	}
+
+	switch marker := ThreadMarker(tag[3]); marker {
+	case MarkerRoot, MarkerReply, MarkerMention:
+		return marker
+	}
+
+	return ""
+}
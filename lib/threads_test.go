@@ -0,0 +1,107 @@
+package lib
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestParseThreadRefs(t *testing.T) {
+	a := strings.Repeat("a", 64)
+	b := strings.Repeat("b", 64)
+	c := strings.Repeat("c", 64)
+
+	tests := []struct {
+		name string
+		tags nostr.Tags
+		want []ThreadRef
+	}{
+		{
+			name: "no references",
+			tags: nostr.Tags{{"p", a}},
+			want: []ThreadRef{},
+		},
+		{
+			name: "marked root and reply",
+			tags: nostr.Tags{
+				{"e", a, "", "root"},
+				{"e", b, "", "reply"},
+			},
+			want: []ThreadRef{
+				{ID: a, Marker: MarkerRoot},
+				{ID: b, Marker: MarkerReply},
+			},
+		},
+		{
+			name: "marked root only replies to root",
+			tags: nostr.Tags{{"e", a, "wss://relay.example.com", "root"}},
+			want: []ThreadRef{
+				{ID: a, Marker: MarkerRoot},
+				{ID: a, Marker: MarkerReply},
+			},
+		},
+		{
+			name: "unmarked alongside marked is a mention",
+			tags: nostr.Tags{
+				{"e", a, "", "root"},
+				{"e", c},
+				{"e", b, "", "reply"},
+			},
+			want: []ThreadRef{
+				{ID: a, Marker: MarkerRoot},
+				{ID: c, Marker: MarkerMention},
+				{ID: b, Marker: MarkerReply},
+			},
+		},
+		{
+			name: "explicit mention",
+			tags: nostr.Tags{{"e", c, "", "mention"}},
+			want: []ThreadRef{{ID: c, Marker: MarkerMention}},
+		},
+		{
+			name: "positional single reference",
+			tags: nostr.Tags{{"e", a}},
+			want: []ThreadRef{
+				{ID: a, Marker: MarkerRoot},
+				{ID: a, Marker: MarkerReply},
+			},
+		},
+		{
+			name: "positional root, mention, and reply",
+			tags: nostr.Tags{{"e", a}, {"e", c}, {"e", b}},
+			want: []ThreadRef{
+				{ID: a, Marker: MarkerRoot},
+				{ID: c, Marker: MarkerMention},
+				{ID: b, Marker: MarkerReply},
+			},
+		},
+		{
+			name: "unknown marker is positional",
+			tags: nostr.Tags{{"e", a, "", "parent"}, {"e", b}},
+			want: []ThreadRef{
+				{ID: a, Marker: MarkerRoot},
+				{ID: b, Marker: MarkerReply},
+			},
+		},
+		{
+			name: "invalid ids are skipped",
+			tags: nostr.Tags{
+				{"e", "not-an-id", "", "root"},
+				{"e"},
+				{"e", b, "", "reply"},
+			},
+			want: []ThreadRef{{ID: b, Marker: MarkerReply}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseThreadRefs(tt.tags)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseThreadRefs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
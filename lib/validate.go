@@ -0,0 +1,121 @@
+// This module provides methods for verifying the integrity of events before
+// they are ingested into the graph.
+
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ========================================
+// Validation
+// ========================================
+
+// ValidateEvent recomputes the NIP-01 id of the event and verifies its Schnorr
+// signature. Returns the reason for rejection and false if the event is
+// invalid.
+func ValidateEvent(event nostr.Event) (RejectReason, bool) {
+	if !nostr.IsValid32ByteHex(event.PubKey) {
+		return ReasonInvalidPubkey, false
+	}
+
+	if !nostr.IsValid32ByteHex(event.ID) || !event.CheckID() {
+		return ReasonInvalidID, false
+	}
+
+	if ok, err := event.CheckSignature(); err != nil || !ok {
+		return ReasonInvalidSignature, false
+	}
+
+	return "", true
+}
+
+// ValidationStats counts the events accepted and rejected by the validation
+// stage.
+type ValidationStats struct {
+	// The number of events that passed validation.
+	Accepted int
+	// The number of events rejected, by reason.
+	Rejected map[RejectReason]int
+}
+
+// NewValidationStats creates an empty set of validation counters.
+func NewValidationStats() *ValidationStats {
+	return &ValidationStats{
+		Rejected: make(map[RejectReason]int),
+	}
+}
+
+// String returns a summary of the counters.
+func (s *ValidationStats) String() string {
+	reasons := []string{}
+	for reason := range s.Rejected {
+		reasons = append(reasons, string(reason))
+	}
+	sort.Strings(reasons)
+
+	summary := fmt.Sprintf("accepted=%d", s.Accepted)
+	for _, reason := range reasons {
+		summary += fmt.Sprintf(
+			" %s=%d", reason, s.Rejected[RejectReason(reason)])
+	}
+	return summary
+}
+
+// ========================================
+// Workers
+// ========================================
+
+// ValidateEvents forwards valid events to ParseEvents and quarantines events
+// that fail validation, logging the per-reason counters when the input is
+// exhausted.
+func ValidateEvents(
+	events chan SourcedEvent,
+	mappers EventMapper,
+	db *Database,
+	quarantine *Quarantine,
+	checkpoints *CheckpointFile,
+	errs chan<- error,
+) {
+	validated := make(chan SourcedEvent)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		ParseEvents(validated, mappers, db, quarantine, checkpoints, errs)
+	}()
+
+	stats := NewValidationStats()
+
+	failed := false
+	for event := range events {
+		if failed {
+			// Drain the input after a failure
+			continue
+		}
+
+		reason, ok := ValidateEvent(event.Event)
+		if !ok {
+			stats.Rejected[reason]++
+			if err := quarantine.RejectEvent(event, reason, nil); err != nil {
+				errs <- &StageError{Stage: "validate", Err: err}
+				failed = true
+			}
+			continue
+		}
+
+		stats.Accepted++
+		validated <- event
+	}
+
+	close(validated)
+	wg.Wait()
+
+	fmt.Println("Validated events:", stats)
+}
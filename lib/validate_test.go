@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestValidateEvent(t *testing.T) {
+	key := strings.Repeat("01", 32)
+	otherKey := strings.Repeat("02", 32)
+	otherPubkey, err := nostr.GetPublicKey(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := nostr.Event{
+		Kind:      nostr.KindTextNote,
+		CreatedAt: 1700000000,
+		Tags:      nostr.Tags{{"t", "nostr"}},
+		Content:   "hello",
+	}
+	if err := signed.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+
+	// forge returns a copy of the signed event with the given changes.
+	forge := func(edit func(*nostr.Event)) nostr.Event {
+		event := signed
+		event.Tags = append(nostr.Tags{}, signed.Tags...)
+		edit(&event)
+		return event
+	}
+
+	tests := []struct {
+		name  string
+		event nostr.Event
+		want  RejectReason
+	}{
+		{
+			name:  "correctly signed",
+			event: signed,
+			want:  "",
+		},
+		{
+			name:  "changed content",
+			event: forge(func(e *nostr.Event) { e.Content = "goodbye" }),
+			want:  ReasonInvalidID,
+		},
+		{
+			name:  "changed tags",
+			event: forge(func(e *nostr.Event) { e.Tags = nostr.Tags{} }),
+			want:  ReasonInvalidID,
+		},
+		{
+			name:  "changed created_at",
+			event: forge(func(e *nostr.Event) { e.CreatedAt++ }),
+			want:  ReasonInvalidID,
+		},
+		{
+			name:  "changed id",
+			event: forge(func(e *nostr.Event) { e.ID = strings.Repeat("e", 64) }),
+			want:  ReasonInvalidID,
+		},
+		{
+			name: "uppercase id",
+			event: forge(func(e *nostr.Event) {
+				e.ID = strings.ToUpper(e.ID)
+			}),
+			want: ReasonInvalidID,
+		},
+		{
+			name: "corrupted signature",
+			event: forge(func(e *nostr.Event) {
+				sig := []byte(e.Sig)
+				sig[10] ^= 1
+				e.Sig = string(sig)
+			}),
+			want: ReasonInvalidSignature,
+		},
+		{
+			name:  "missing signature",
+			event: forge(func(e *nostr.Event) { e.Sig = "" }),
+			want:  ReasonInvalidSignature,
+		},
+		{
+			name: "signature from another key",
+			event: forge(func(e *nostr.Event) {
+				e.PubKey = otherPubkey
+				e.ID = e.GetID()
+			}),
+			want: ReasonInvalidSignature,
+		},
+		{
+			name: "uppercase pubkey",
+			event: forge(func(e *nostr.Event) {
+				e.PubKey = strings.ToUpper(e.PubKey)
+			}),
+			want: ReasonInvalidPubkey,
+		},
+		{
+			name:  "short pubkey",
+			event: forge(func(e *nostr.Event) { e.PubKey = e.PubKey[:62] }),
+			want:  ReasonInvalidPubkey,
+		},
+		{
+			name:  "missing pubkey",
+			event: forge(func(e *nostr.Event) { e.PubKey = "" }),
+			want:  ReasonInvalidPubkey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, ok := ValidateEvent(tt.event)
+			if reason != tt.want || ok != (tt.want == "") {
+				t.Errorf("ValidateEvent() = %q, %v, want %q, %v",
+					reason, ok, tt.want, tt.want == "")
+			}
+		})
+	}
+}
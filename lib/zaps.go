@@ -0,0 +1,237 @@
+// This module provides the mapping for NIP-57 zap receipts.
+
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip60"
+)
+
+// ========================================
+// Zap Receipt Mapper
+// ========================================
+
+// ZapReceiptMapper maps a zap receipt to a ZapReceiptEvent node carrying the
+// amount decoded from its bolt11 invoice. The zap request embedded in the
+// receipt's description identifies the sender, who is linked to the recipient
+// and the zapped event with ZAPPED relationships. The receipt's author is the
+// recipient's zapper service and is kept separate from the sender.
+type ZapReceiptMapper struct{}
+
+func (ZapReceiptMapper) Map(event nostr.Event) (*Subgraph, []TagRejection) {
+	mapping := NewEventMapping(event)
+
+	// Event is a zap receipt
+	mapping.EventNode.Labels.Add("ZapReceiptEvent")
+
+	var bolt11Tag, descriptionTag nostr.Tag
+
+	mapping.MapTags(func(tag nostr.Tag) bool {
+		switch tag[0] {
+		case "bolt11":
+			bolt11Tag = tag
+		case "description":
+			descriptionTag = tag
+		}
+
+		// Zap tags are also kept as generic tags.
+		return false
+	})
+
+	if bolt11Tag == nil {
+		return mapping.Result()
+	}
+
+	// Write the zap amount to the event
+	amount, err := nip60.GetSatoshisAmountFromBolt11(bolt11Tag[1])
+	if err != nil {
+		mapping.Reject(bolt11Tag, ReasonInvalidBolt11, err)
+		return mapping.Result()
+	}
+	mapping.EventNode.Props["amount"] = amount
+
+	if descriptionTag == nil {
+		return mapping.Result()
+	}
+
+	zap, err := ParseZap(event, bolt11Tag[1], descriptionTag[1])
+	if errors.Is(err, ErrDescriptionHashMismatch) {
+		mapping.Reject(descriptionTag, ReasonDescriptionHashMismatch, err)
+		return mapping.Result()
+	}
+	if err != nil {
+		mapping.Reject(descriptionTag, ReasonInvalidZapRequest, err)
+		return mapping.Result()
+	}
+
+	zapProps := Properties{
+		"receipt_id": event.ID,
+		"request_id": zap.RequestID,
+		"amount":     amount,
+		"created_at": event.CreatedAt.Time().Unix(),
+		"zapper":     event.PubKey,
+		"anonymous":  zap.Anonymous,
+	}
+
+	senderNode := NewUserNode(zap.Sender)
+	recipientNode := NewUserNode(zap.Recipient)
+	zappedUserRel := NewZappedUserRel(senderNode, recipientNode, zapProps)
+
+	mapping.Subgraph.AddNode(senderNode)
+	mapping.Subgraph.AddNode(recipientNode)
+	mapping.Subgraph.AddRel(zappedUserRel)
+
+	if zap.EventID != "" {
+		zappedEventNode := NewEventNode(zap.EventID)
+		zappedEventRel := NewZappedEventRel(
+			senderNode, zappedEventNode, zapProps)
+
+		mapping.Subgraph.AddNode(zappedEventNode)
+		mapping.Subgraph.AddRel(zappedEventRel)
+	}
+
+	return mapping.Result()
+}
+
+// ========================================
+// Zaps
+// ========================================
+
+// ErrDescriptionHashMismatch is returned when the description hash committed
+// to by a zap receipt's invoice does not match its zap request.
+var ErrDescriptionHashMismatch = errors.New(
+	"invoice description hash does not match zap request")
+
+// Zap describes a payment identified from a zap receipt and its embedded zap
+// request.
+type Zap struct {
+	// The id of the zap request.
+	RequestID string
+	// The pubkey of the user who sent the zap.
+	Sender string
+	// The pubkey of the user who received the zap.
+	Recipient string
+	// The id of the zapped event, if any.
+	EventID string
+	// Whether the zap request was signed with a throwaway key.
+	Anonymous bool
+}
+
+// ParseZap verifies the zap request embedded in a zap receipt's description
+// and returns the zap it describes. The request must be a validly signed kind
+// 9734 event whose hash matches the description hash of the invoice, and its
+// recipient must match the receipt's.
+func ParseZap(receipt nostr.Event, bolt11 string, description string) (
+	*Zap, error) {
+
+	request := nostr.Event{}
+	if err := json.Unmarshal([]byte(description), &request); err != nil {
+		return nil, fmt.Errorf("invalid zap request: %w", err)
+	}
+
+	if request.Kind != nostr.KindZapRequest {
+		return nil, fmt.Errorf("invalid zap request kind: %d", request.Kind)
+	}
+
+	if reason, ok := ValidateEvent(request); !ok {
+		return nil, fmt.Errorf("invalid zap request: %s", reason)
+	}
+
+	hash, err := bolt11DescriptionHash(bolt11)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bolt11: %w", err)
+	}
+
+	expected := sha256.Sum256([]byte(description))
+	if !bytes.Equal(hash, expected[:]) {
+		return nil, ErrDescriptionHashMismatch
+	}
+
+	recipient := tagValue(receipt.Tags, "p")
+	if !isHexID(recipient) || recipient != tagValue(request.Tags, "p") {
+		return nil, fmt.Errorf("zap recipient does not match zap request")
+	}
+
+	// The receipt's optional P tag must name the request's author.
+	if sender := tagValue(receipt.Tags, "P"); sender != "" &&
+		sender != request.PubKey {
+		return nil, fmt.Errorf("zap sender does not match zap request")
+	}
+
+	eventID := tagValue(receipt.Tags, "e")
+	if !isHexID(eventID) {
+		eventID = ""
+	}
+
+	return &Zap{
+		RequestID: request.ID,
+		Sender:    request.PubKey,
+		Recipient: recipient,
+		EventID:   eventID,
+		Anonymous: hasTag(request.Tags, "anon"),
+	}, nil
+}
+
+// bolt11DescriptionHashType is the bech32 value of the "h" tagged field of a
+// bolt11 invoice.
+const bolt11DescriptionHashType = 23
+
+// bolt11DescriptionHash returns the description hash committed to by the
+// tagged fields of a bolt11 invoice.
+func bolt11DescriptionHash(invoice string) ([]byte, error) {
+	_, data, err := bech32.DecodeNoLimit(invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	// The data is a 35-bit timestamp followed by tagged fields and a 520-bit
+	// signature, in 5-bit groups.
+	const timestampLength = 7
+	const signatureLength = 104
+	if len(data) < timestampLength+signatureLength {
+		return nil, fmt.Errorf("invoice too short")
+	}
+	fields := data[timestampLength : len(data)-signatureLength]
+
+	for len(fields) >= 3 {
+		fieldType := fields[0]
+		length := int(fields[1])<<5 | int(fields[2])
+		if len(fields) < 3+length {
+			return nil, fmt.Errorf("truncated tagged field")
+		}
+		value := fields[3 : 3+length]
+		fields = fields[3+length:]
+
+		if fieldType == bolt11DescriptionHashType {
+			return bech32.ConvertBits(value, 5, 8, false)
+		}
+	}
+
+	return nil, fmt.Errorf("invoice has no description hash")
+}
+
+// hasTag reports whether the tags include one with exactly the given name.
+func hasTag(tags nostr.Tags, name string) bool {
+	for _, tag := range tags {
+		if len(tag) > 0 && tag[0] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// tagValue returns the value of the first tag with the given name, or an
+// empty string if there is none.
+func tagValue(tags nostr.Tags, name string) string {
+	if tag := tags.GetFirst([]string{name, ""}); tag != nil {
+		return tag.Value()
+	}
+	return ""
+}
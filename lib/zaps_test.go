@@ -0,0 +1,273 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// testInvoice encodes a bolt11 invoice with the given tagged fields, in 5-bit
+// groups, and a zero timestamp and signature.
+func testInvoice(t *testing.T, fields ...[]byte) string {
+	t.Helper()
+
+	data := make([]byte, 7)
+	for _, field := range fields {
+		data = append(data, field...)
+	}
+	data = append(data, make([]byte, 104)...)
+
+	invoice, err := bech32.Encode("lnbc10u", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return invoice
+}
+
+// testField encodes a bolt11 tagged field of the given type.
+func testField(t *testing.T, fieldType byte, value []byte) []byte {
+	t.Helper()
+
+	groups, err := bech32.ConvertBits(value, 8, 5, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	field := []byte{fieldType, byte(len(groups) >> 5), byte(len(groups) & 31)}
+	return append(field, groups...)
+}
+
+func TestBolt11DescriptionHash(t *testing.T) {
+	hash := sha256.Sum256([]byte("description"))
+	paymentHash := sha256.Sum256([]byte("preimage"))
+
+	tests := []struct {
+		name    string
+		invoice string
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name:    "description hash only",
+			invoice: testInvoice(t, testField(t, bolt11DescriptionHashType, hash[:])),
+			want:    hash[:],
+		},
+		{
+			name: "description hash after other fields",
+			invoice: testInvoice(t,
+				testField(t, 1, paymentHash[:]),
+				testField(t, 13, []byte("memo")),
+				testField(t, bolt11DescriptionHashType, hash[:])),
+			want: hash[:],
+		},
+		{
+			name:    "no description hash",
+			invoice: testInvoice(t, testField(t, 1, paymentHash[:])),
+			wantErr: true,
+		},
+		{
+			name:    "truncated field",
+			invoice: testInvoice(t, []byte{bolt11DescriptionHashType, 1, 31, 0, 0}),
+			wantErr: true,
+		},
+		{
+			name:    "too short",
+			invoice: "lnbc1qqqqqqqqqqqqqqqq",
+			wantErr: true,
+		},
+		{
+			name:    "not bech32",
+			invoice: "not an invoice",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bolt11DescriptionHash(tt.invoice)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %x, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed: %s", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseZap(t *testing.T) {
+	senderKey := strings.Repeat("01", 32)
+	sender, err := nostr.GetPublicKey(senderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient := strings.Repeat("b", 64)
+	zapped := strings.Repeat("e", 64)
+
+	// newRequest returns a signed zap request and its JSON description.
+	newRequest := func(edit func(*nostr.Event)) (nostr.Event, string) {
+		request := nostr.Event{
+			Kind:      nostr.KindZapRequest,
+			CreatedAt: 1700000000,
+			Tags: nostr.Tags{
+				{"p", recipient},
+				{"e", zapped},
+				{"relays", "wss://relay.example.com"},
+			},
+		}
+		if edit != nil {
+			edit(&request)
+		}
+		if err := request.Sign(senderKey); err != nil {
+			t.Fatal(err)
+		}
+		return request, request.String()
+	}
+
+	// invoiceFor returns an invoice committing to the given description.
+	invoiceFor := func(description string) string {
+		hash := sha256.Sum256([]byte(description))
+		return testInvoice(t, testField(t, bolt11DescriptionHashType, hash[:]))
+	}
+
+	receipt := nostr.Event{
+		Kind: nostr.KindZap,
+		Tags: nostr.Tags{{"p", recipient}, {"e", zapped}, {"P", sender}},
+	}
+
+	request, description := newRequest(nil)
+	anonRequest, anonDescription := newRequest(func(e *nostr.Event) {
+		e.Tags = append(e.Tags, nostr.Tag{"anon"})
+	})
+	namedRequest, namedDescription := newRequest(func(e *nostr.Event) {
+		e.Tags = append(e.Tags, nostr.Tag{"anonymous"})
+	})
+	_, otherRecipient := newRequest(func(e *nostr.Event) {
+		e.Tags[0] = nostr.Tag{"p", strings.Repeat("c", 64)}
+	})
+	_, wrongKind := newRequest(func(e *nostr.Event) {
+		e.Kind = nostr.KindTextNote
+	})
+	tampered := strings.Replace(description, "relay.example.com", "x.com", 1)
+
+	tests := []struct {
+		name        string
+		receipt     nostr.Event
+		invoice     string
+		description string
+		want        *Zap
+		wantErr     error
+	}{
+		{
+			name:        "valid",
+			receipt:     receipt,
+			invoice:     invoiceFor(description),
+			description: description,
+			want: &Zap{
+				RequestID: request.ID,
+				Sender:    sender,
+				Recipient: recipient,
+				EventID:   zapped,
+			},
+		},
+		{
+			name:        "anonymous",
+			receipt:     receipt,
+			invoice:     invoiceFor(anonDescription),
+			description: anonDescription,
+			want: &Zap{
+				RequestID: anonRequest.ID,
+				Sender:    sender,
+				Recipient: recipient,
+				EventID:   zapped,
+				Anonymous: true,
+			},
+		},
+		{
+			name:        "tag name starting with anon",
+			receipt:     receipt,
+			invoice:     invoiceFor(namedDescription),
+			description: namedDescription,
+			want: &Zap{
+				RequestID: namedRequest.ID,
+				Sender:    sender,
+				Recipient: recipient,
+				EventID:   zapped,
+			},
+		},
+		{
+			name:        "description hash mismatch",
+			receipt:     receipt,
+			invoice:     invoiceFor("other"),
+			description: description,
+			wantErr:     ErrDescriptionHashMismatch,
+		},
+		{
+			name:        "tampered request",
+			receipt:     receipt,
+			invoice:     invoiceFor(tampered),
+			description: tampered,
+		},
+		{
+			name:        "wrong kind",
+			receipt:     receipt,
+			invoice:     invoiceFor(wrongKind),
+			description: wrongKind,
+		},
+		{
+			name:        "recipient mismatch",
+			receipt:     receipt,
+			invoice:     invoiceFor(otherRecipient),
+			description: otherRecipient,
+		},
+		{
+			name: "sender mismatch",
+			receipt: nostr.Event{
+				Kind: nostr.KindZap,
+				Tags: nostr.Tags{
+					{"p", recipient},
+					{"P", strings.Repeat("d", 64)},
+				},
+			},
+			invoice:     invoiceFor(description),
+			description: description,
+		},
+		{
+			name:        "invalid json",
+			receipt:     receipt,
+			invoice:     invoiceFor("{"),
+			description: "{",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseZap(tt.receipt, tt.invoice, tt.description)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("got %+v, want error", got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("got error %q, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed: %s", err)
+			}
+			if *got != *tt.want {
+				t.Errorf("got %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+}
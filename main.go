@@ -1,19 +1,202 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"main/lib"
 )
 
+// Exit codes
+const (
+	exitFailure = 1
+	exitUsage   = 2
+	// The import was interrupted and stopped after merging the events
+	// already read.
+	exitInterrupted = 3
+	// The import was interrupted a second time and exited immediately.
+	exitForced = 4
+)
+
 func main() {
+	maxLineSize := flag.Int("max-line-size", lib.DefaultMaxLineSize,
+		"maximum size in bytes of a single input line")
+	maxLines := flag.Int("max-lines", 0,
+		"maximum number of lines to read across all inputs (0 for no limit)")
+	quarantinePath := flag.String("quarantine", "",
+		"path of the dead-letter JSONL file for rejected events and tags")
+	checkpointPath := flag.String("checkpoint", "",
+		"path of the file that records the import's progress after each batch")
+	resume := flag.Bool("resume", false,
+		"resume the import from the checkpoint file")
+	profileHistory := flag.Bool("profile-history", false,
+		"link every profile metadata event to its author as HAD_PROFILE")
+	contentHashtags := flag.Bool("content-hashtags", false,
+		"extract hashtags from the content of text notes")
+	deletionPolicy := flag.String("deletion-policy", string(lib.DeletionMark),
+		"how deletion requests are applied: mark or purge")
+	configPath := flag.String("config", os.Getenv(lib.ConfigPathEnv),
+		"path of the YAML config file")
+	neo4jURI := flag.String("neo4j-uri", "",
+		"Neo4j connection URI")
+	neo4jAuth := flag.String("neo4j-auth", "",
+		"Neo4j auth scheme: basic, bearer, or none")
+	neo4jUser := flag.String("neo4j-user", "",
+		"Neo4j username for basic auth")
+	neo4jPassword := flag.String("neo4j-password", "",
+		"Neo4j password for basic auth")
+	neo4jToken := flag.String("neo4j-token", "",
+		"Neo4j token for bearer auth")
+	neo4jDatabase := flag.String("neo4j-database", "",
+		"Neo4j database to import into")
+	neo4jCACert := flag.String("neo4j-ca-cert", "",
+		"path of a PEM file of certificate authorities to trust for Neo4j TLS")
+	neo4jMaxConnections := flag.Int("neo4j-max-connections", 0,
+		"maximum number of Neo4j connections per server")
+	neo4jAcquisitionTimeout := flag.Duration("neo4j-acquisition-timeout", 0,
+		"how long to wait for a Neo4j connection from the pool")
+	neo4jMaxConnectionLifetime := flag.Duration(
+		"neo4j-max-connection-lifetime", 0,
+		"how long a Neo4j connection is kept before it is replaced")
+	neo4jRetryMaxAttempts := flag.Int("neo4j-retry-max-attempts", 0,
+		"maximum number of attempts of a Neo4j write that fails transiently")
+	neo4jRetryInitialBackoff := flag.Duration("neo4j-retry-initial-backoff", 0,
+		"delay before the first retry of a failed Neo4j write")
+	neo4jRetryMaxBackoff := flag.Duration("neo4j-retry-max-backoff", 0,
+		"maximum delay between retries of a failed Neo4j write")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"Usage: %s [flags] <file|glob|dir|->...\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "\n"+
+			"On SIGINT or SIGTERM, reading stops and the events already read are\n"+
+			"merged and checkpointed before exiting with status %d. A second\n"+
+			"signal exits immediately with status %d.\n",
+			exitInterrupted, exitForced)
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	if *resume && *checkpointPath == "" {
+		fmt.Fprintln(os.Stderr, "-resume requires -checkpoint")
+		os.Exit(exitUsage)
+	}
+
+	policy, err := lib.ParseDeletionPolicy(*deletionPolicy)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+
+	config, err := lib.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+
+	// Flags take precedence over the config file and environment
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "neo4j-uri":
+			config.Neo4j.URI = *neo4jURI
+		case "neo4j-auth":
+			config.Neo4j.Auth.Scheme = lib.AuthScheme(*neo4jAuth)
+		case "neo4j-user":
+			config.Neo4j.Auth.Username = *neo4jUser
+		case "neo4j-password":
+			config.Neo4j.Auth.Password = *neo4jPassword
+		case "neo4j-token":
+			config.Neo4j.Auth.Token = *neo4jToken
+		case "neo4j-database":
+			config.Neo4j.Database = *neo4jDatabase
+		case "neo4j-ca-cert":
+			config.Neo4j.TLS.CACert = *neo4jCACert
+		case "neo4j-max-connections":
+			config.Neo4j.Pool.MaxConnections = *neo4jMaxConnections
+		case "neo4j-acquisition-timeout":
+			config.Neo4j.Pool.AcquisitionTimeout = *neo4jAcquisitionTimeout
+		case "neo4j-max-connection-lifetime":
+			config.Neo4j.Pool.MaxConnectionLifetime = *neo4jMaxConnectionLifetime
+		case "neo4j-retry-max-attempts":
+			config.Neo4j.Retry.MaxAttempts = *neo4jRetryMaxAttempts
+		case "neo4j-retry-initial-backoff":
+			config.Neo4j.Retry.InitialBackoff = *neo4jRetryInitialBackoff
+		case "neo4j-retry-max-backoff":
+			config.Neo4j.Retry.MaxBackoff = *neo4jRetryMaxBackoff
+		}
+	})
+
+	if err := config.Neo4j.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+
+	ctx := interruptContext()
 	start := time.Now()
 
-	lib.ImportEvents()
+	err = lib.ImportEvents(ctx, lib.ImportOptions{
+		Inputs:         flag.Args(),
+		MaxLineSize:    *maxLineSize,
+		MaxLines:       *maxLines,
+		QuarantinePath: *quarantinePath,
+		CheckpointPath: *checkpointPath,
+		Resume:         *resume,
+		Mapping: lib.MapperOptions{
+			ProfileHistory:  *profileHistory,
+			ContentHashtags: *contentHashtags,
+			DeletionPolicy:  policy,
+		},
+		Neo4j: config.Neo4j,
+	})
 
 	end := time.Now()
 	fmt.Println("Runtime:", formatDuration(start, end))
+
+	if errors.Is(err, lib.ErrInterrupted) {
+		fmt.Fprintln(os.Stderr, "Import interrupted.")
+		if *checkpointPath != "" {
+			fmt.Fprintln(os.Stderr, "Run again with -resume to continue.")
+		}
+		os.Exit(exitInterrupted)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Import failed:", err)
+		os.Exit(exitFailure)
+	}
+}
+
+// interruptContext returns a context that is cancelled on the first SIGINT or
+// SIGTERM, letting the import stop gracefully. A second signal exits
+// immediately.
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		fmt.Fprintf(os.Stderr, "Received %s, stopping after the events "+
+			"already read are merged. Repeat to exit immediately.\n", sig)
+		cancel()
+
+		<-signals
+		fmt.Fprintln(os.Stderr, "Exiting immediately.")
+		os.Exit(exitForced)
+	}()
+
+	return ctx
 }
 
 func formatDuration(start time.Time, end time.Time) string {